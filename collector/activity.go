@@ -16,9 +16,9 @@
 package collector
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log/slog"
+	"net/url"
 	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -47,14 +47,18 @@ type JellyfinUserActivity struct {
 
 type activityCollector struct {
 	activityReport *prometheus.Desc
+	days           string
+	client         *utils.Client
 	logger         *slog.Logger
 }
 
 func init() {
 	registerCollector("activity", defaultDisabled, NewActivityCollector)
+	registerCollectorOptions("activity", "days")
+	registerRequiredPlugin("activity", "Playback Reporting")
 }
 
-func NewActivityCollector(logger *slog.Logger) (Collector, error) {
+func NewActivityCollector(logger *slog.Logger, target config.Target) (Collector, error) {
 	const subsystem = "activity"
 	activityReport := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "count"),
@@ -68,31 +72,22 @@ func NewActivityCollector(logger *slog.Logger) (Collector, error) {
 	)
 	return &activityCollector{
 		activityReport: activityReport,
+		days:           config.CollectorOption("activity", "days", *jellyfinReportDays),
+		client:         utils.NewClient(target),
 		logger:         logger,
 	}, nil
 }
 
-func getUserActivity(jellyfinURL, jellyfinToken, days string) ([]JellyfinUserActivity, error) {
-	jellyfinAPIURL := fmt.Sprintf("%s/user_usage_stats/user_activity?days=%s", jellyfinURL, days)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
-	rawBody, err := utils.CoerceToJSONBytes(rawData)
-	if err != nil {
-		return nil, err
-	}
+func getUserActivity(ctx context.Context, client *utils.Client, days string) ([]JellyfinUserActivity, error) {
 	var activityList []JellyfinUserActivity
-	if err := json.Unmarshal(rawBody, &activityList); err != nil {
-		return nil, fmt.Errorf("unexpected response from Jellyfin API: %w", err)
+	if err := client.Get(ctx, "/user_usage_stats/user_activity?days="+url.QueryEscape(days), &activityList); err != nil {
+		return nil, err
 	}
 	return activityList, nil
 }
 
-func (c *activityCollector) Update(ch chan<- prometheus.Metric) error {
-	jellyfinURL, jellyfinToken, err := config.JellyfinInfo(c.logger)
-	if err != nil {
-		c.logger.Error("Failed to get Jellyfin config", "error", err)
-		return err
-	}
-	activityList, err := getUserActivity(jellyfinURL, jellyfinToken, *jellyfinReportDays)
+func (c *activityCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	activityList, err := getUserActivity(ctx, c.client, c.days)
 	if err != nil {
 		c.logger.Error("Failed to get user activity", "error", err)
 		return err
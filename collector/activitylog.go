@@ -0,0 +1,195 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noactivitylog
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+const (
+	activityLogPageSize = 100
+	activityLogMaxPages = 10
+)
+
+type JellyfinActivityLogEntry struct {
+	Id       int64  `json:"Id"`
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Date     string `json:"Date"`
+	UserId   string `json:"UserId"`
+	Severity string `json:"Severity"`
+}
+
+type JellyfinActivityLogResult struct {
+	Items            []JellyfinActivityLogEntry `json:"Items"`
+	TotalRecordCount int64                      `json:"TotalRecordCount"`
+}
+
+type activityLogKey struct {
+	eventType string
+	severity  string
+}
+
+// activityLogKnownEvents start at 0 when the baseline is taken, so that
+// increase() and rate() see the first entries of these types as well.
+var activityLogKnownEvents = []activityLogKey{
+	{eventType: "AuthenticationFailed", severity: "Error"},
+	{eventType: "AuthenticationSucceeded", severity: "Information"},
+	{eventType: "SessionStarted", severity: "Information"},
+	{eventType: "SessionEnded", severity: "Information"},
+}
+
+// activityLogTail remembers the newest activity log entry seen on a server
+// and counts the entries added after it, starting from the newest entry
+// present when the server was first scraped.
+type activityLogTail struct {
+	mtx         sync.Mutex
+	initialized bool
+	lastID      int64
+	lastDate    string
+	counts      map[activityLogKey]float64
+}
+
+// activityLogTails keeps the tail of every server across config reloads,
+// which build new collectors, so that no entries and counts are lost.
+var (
+	activityLogTailsMtx = sync.Mutex{}
+	activityLogTails    = make(map[string]*activityLogTail)
+)
+
+func activityLogTailFor(url string) *activityLogTail {
+	activityLogTailsMtx.Lock()
+	defer activityLogTailsMtx.Unlock()
+	tail, ok := activityLogTails[url]
+	if !ok {
+		tail = &activityLogTail{counts: make(map[activityLogKey]float64)}
+		activityLogTails[url] = tail
+	}
+	return tail
+}
+
+type activityLogCollector struct {
+	events *prometheus.Desc
+	client *utils.Client
+	tail   *activityLogTail
+	logger *slog.Logger
+}
+
+func init() {
+	registerCollector("activitylog", defaultEnabled, NewActivityLogCollector)
+	// A collector built for a single probe never sees new entries.
+	excludeFromProbe("activitylog")
+}
+
+func NewActivityLogCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "activity_log"
+	events := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "events_total"),
+		"Jellyfin activity log entries seen by the exporter.",
+		[]string{"type", "severity"}, nil,
+	)
+	return &activityLogCollector{
+		events: events,
+		client: utils.NewClient(target),
+		tail:   activityLogTailFor(target.URL),
+		logger: logger,
+	}, nil
+}
+
+func getActivityLogEntries(ctx context.Context, client *utils.Client, startIndex, limit int, minDate string) ([]JellyfinActivityLogEntry, error) {
+	query := url.Values{}
+	query.Set("startIndex", strconv.Itoa(startIndex))
+	query.Set("limit", strconv.Itoa(limit))
+	if minDate != "" {
+		query.Set("minDate", minDate)
+	}
+	var result JellyfinActivityLogResult
+	if err := client.Get(ctx, "/System/ActivityLog/Entries?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	return result.Items, nil
+}
+
+// newEntries returns the entries added since the last call, newest first.
+func (c *activityLogCollector) newEntries(ctx context.Context) ([]JellyfinActivityLogEntry, error) {
+	var entries []JellyfinActivityLogEntry
+	for page := 0; page < activityLogMaxPages; page++ {
+		items, err := getActivityLogEntries(ctx, c.client, page*activityLogPageSize, activityLogPageSize, c.tail.lastDate)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if item.Id <= c.tail.lastID {
+				return entries, nil
+			}
+			entries = append(entries, item)
+		}
+		if len(items) < activityLogPageSize {
+			return entries, nil
+		}
+	}
+	c.logger.Warn("Too many new activity log entries, some were skipped", "limit", activityLogPageSize*activityLogMaxPages)
+	return entries, nil
+}
+
+func (c *activityLogCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	tail := c.tail
+	tail.mtx.Lock()
+	defer tail.mtx.Unlock()
+
+	if !tail.initialized {
+		items, err := getActivityLogEntries(ctx, c.client, 0, 1, "")
+		if err != nil {
+			c.logger.Error("Failed to get activity log", "error", err)
+			return err
+		}
+		if len(items) > 0 {
+			tail.lastID, tail.lastDate = items[0].Id, items[0].Date
+		}
+		for _, key := range activityLogKnownEvents {
+			tail.counts[key] = 0
+		}
+		tail.initialized = true
+		c.logger.Debug("Jellyfin activity log baseline", "Id", tail.lastID)
+	} else {
+		entries, err := c.newEntries(ctx)
+		if err != nil {
+			c.logger.Error("Failed to get activity log", "error", err)
+			return err
+		}
+		for _, entry := range entries {
+			c.logger.Debug("Jellyfin activity log entry", "Id", entry.Id, "Type", entry.Type, "Severity", entry.Severity)
+			tail.counts[activityLogKey{eventType: entry.Type, severity: entry.Severity}]++
+		}
+		if len(entries) > 0 {
+			tail.lastID, tail.lastDate = entries[0].Id, entries[0].Date
+		}
+	}
+
+	for key, count := range tail.counts {
+		ch <- prometheus.MustNewConstMetric(c.events, prometheus.CounterValue, count, key.eventType, key.severity)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noactivitylog
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// fakeActivityLog serves an activity log, newest entry first, and counts the
+// pages requested.
+type fakeActivityLog struct {
+	mtx      sync.Mutex
+	entries  []JellyfinActivityLogEntry
+	requests int
+}
+
+func (l *fakeActivityLog) add(eventType, severity string, n int) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for i := 0; i < n; i++ {
+		id := int64(len(l.entries) + 1)
+		entry := JellyfinActivityLogEntry{Id: id, Type: eventType, Severity: severity, Date: "2026-01-01T00:00:00Z"}
+		l.entries = append([]JellyfinActivityLogEntry{entry}, l.entries...)
+	}
+}
+
+func (l *fakeActivityLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.requests++
+	start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	start = min(start, len(l.entries))
+	end := min(start+limit, len(l.entries))
+	_ = json.NewEncoder(w).Encode(JellyfinActivityLogResult{Items: l.entries[start:end], TotalRecordCount: int64(len(l.entries))})
+}
+
+func (l *fakeActivityLog) requestCount() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.requests
+}
+
+// updateActivityLog builds a collector for url, as a reload does, runs it
+// once and returns the counts by type and severity.
+func updateActivityLog(t *testing.T, url string) map[activityLogKey]float64 {
+	t.Helper()
+	c, err := NewActivityLogCollector(slog.New(slog.DiscardHandler), config.Target{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 100)
+	if err := c.Update(context.Background(), ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	counts := make(map[activityLogKey]float64)
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		var key activityLogKey
+		for _, lp := range pb.Label {
+			switch lp.GetName() {
+			case "type":
+				key.eventType = lp.GetValue()
+			case "severity":
+				key.severity = lp.GetValue()
+			}
+		}
+		counts[key] = pb.Counter.GetValue()
+	}
+	return counts
+}
+
+func TestActivityLogTail(t *testing.T) {
+	log := &fakeActivityLog{}
+	log.add("SessionStarted", "Information", 3)
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+
+	failed := activityLogKey{eventType: "AuthenticationFailed", severity: "Error"}
+	started := activityLogKey{eventType: "SessionStarted", severity: "Information"}
+	updated := activityLogKey{eventType: "PluginUpdated", severity: "Information"}
+
+	counts := updateActivityLog(t, srv.URL)
+	if len(counts) != len(activityLogKnownEvents) || counts[failed] != 0 || counts[started] != 0 {
+		t.Fatalf("baseline: got %v, want the known events at 0", counts)
+	}
+
+	log.add("AuthenticationFailed", "Error", 2)
+	log.add("PluginUpdated", "Information", 1)
+	counts = updateActivityLog(t, srv.URL)
+	if counts[failed] != 2 || counts[updated] != 1 || counts[started] != 0 {
+		t.Errorf("got %v, want 2 failed logins and 1 plugin update", counts)
+	}
+
+	// More entries than fit on a page, the tail survives the rebuilt
+	// collector and stops at the last entry seen.
+	log.add("AuthenticationFailed", "Error", activityLogPageSize+50)
+	requests := log.requestCount()
+	counts = updateActivityLog(t, srv.URL)
+	if want := float64(activityLogPageSize + 52); counts[failed] != want {
+		t.Errorf("got %v failed logins, want %v", counts[failed], want)
+	}
+	if n := log.requestCount() - requests; n != 2 {
+		t.Errorf("got %d page requests, want 2", n)
+	}
+
+	counts = updateActivityLog(t, srv.URL)
+	if want := float64(activityLogPageSize + 52); counts[failed] != want {
+		t.Errorf("got %v failed logins without new entries, want %v", counts[failed], want)
+	}
+}
+
+func TestActivityLogMaxPages(t *testing.T) {
+	log := &fakeActivityLog{}
+	srv := httptest.NewServer(log)
+	defer srv.Close()
+
+	updateActivityLog(t, srv.URL)
+	log.add("SessionEnded", "Information", activityLogPageSize*(activityLogMaxPages+2))
+	requests := log.requestCount()
+	counts := updateActivityLog(t, srv.URL)
+	ended := activityLogKey{eventType: "SessionEnded", severity: "Information"}
+	if want := float64(activityLogPageSize * activityLogMaxPages); counts[ended] != want {
+		t.Errorf("got %v entries, want %v", counts[ended], want)
+	}
+	if n := log.requestCount() - requests; n != activityLogMaxPages {
+		t.Errorf("got %d page requests, want %d", n, activityLogMaxPages)
+	}
+}
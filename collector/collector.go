@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -22,6 +23,9 @@ import (
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
 )
 
 const namespace = "jellyfin"
@@ -39,6 +43,16 @@ var (
 		[]string{"collector"},
 		nil,
 	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_timeout"),
+		"jellyfin_exporter: Whether a collector ran into its timeout.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+var (
+	collectorTimeout = kingpin.Flag("collector.timeout", "Maximum duration of a single collector scrape. Use 0 to disable.").Default("10s").Duration()
 )
 
 const (
@@ -47,14 +61,17 @@ const (
 )
 
 var (
-	factories              = make(map[string]func(logger *slog.Logger) (Collector, error))
+	factories              = make(map[string]func(logger *slog.Logger, target config.Target) (Collector, error))
 	initiatedCollectorsMtx = sync.Mutex{}
 	initiatedCollectors    = make(map[string]Collector)
 	collectorState         = make(map[string]*bool)
+	flagCollectorState     map[string]bool
 	forcedCollectors       = map[string]bool{}
+	requiredPlugins        = make(map[string][]string)
+	probeExcluded          = make(map[string]bool)
 )
 
-func registerCollector(collector string, isDefaultEnabled bool, factory func(logger *slog.Logger) (Collector, error)) {
+func registerCollector(collector string, isDefaultEnabled bool, factory func(logger *slog.Logger, target config.Target) (Collector, error)) {
 	var helpDefaultState string
 	if isDefaultEnabled {
 		helpDefaultState = "enabled"
@@ -70,11 +87,45 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 	collectorState[collector] = flag
 
 	factories[collector] = factory
+	config.RegisterCollector(collector)
+}
+
+// registerCollectorOptions declares the options collector reads from the
+// config file with config.CollectorOption.
+func registerCollectorOptions(collector string, options ...string) {
+	config.RegisterCollector(collector, options...)
+}
+
+// excludeFromProbe keeps collector out of /probe, for collectors that only
+// work when they live across scrapes.
+func excludeFromProbe(collector string) {
+	probeExcluded[collector] = true
+}
+
+// registerRequiredPlugin records that collector only works with the named
+// Jellyfin plugin installed, so the plugins collector can report it missing.
+func registerRequiredPlugin(collector, plugin string) {
+	requiredPlugins[collector] = append(requiredPlugins[collector], plugin)
+}
+
+// enabledRequiredPlugins returns the plugins needed by the enabled collectors.
+// Callers must hold initiatedCollectorsMtx, as collector factories do.
+func enabledRequiredPlugins() map[string][]string {
+	plugins := make(map[string][]string)
+	for collector, names := range requiredPlugins {
+		if enabled, ok := collectorState[collector]; ok && *enabled {
+			plugins[collector] = names
+		}
+	}
+	return plugins
 }
 
 type JellyfinCollector struct {
 	Collectors map[string]Collector
-	logger     *slog.Logger
+	// Target is the URL of the Jellyfin server the collectors talk to.
+	Target string
+	ctx    context.Context
+	logger *slog.Logger
 }
 
 func DisableDefaultCollectors() {
@@ -92,21 +143,65 @@ func collectorFlagAction(collector string) func(ctx *kingpin.ParseContext) error
 	}
 }
 
+// ApplyConfig enables and disables collectors according to the config file
+// and drops all cached collectors, stopping their background refresh, so that
+// the next NewJellyfinCollector call builds them again with the current
+// settings. Collectors the file doesn't mention fall back to their
+// command-line state.
+func ApplyConfig() error {
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
+
+	if flagCollectorState == nil {
+		flagCollectorState = make(map[string]bool)
+		for c, enabled := range collectorState {
+			flagCollectorState[c] = *enabled
+		}
+	}
+	for _, c := range config.CollectorNames() {
+		if _, ok := collectorState[c]; !ok {
+			return fmt.Errorf("unknown collector in config file: %s", c)
+		}
+	}
+	for c := range collectorState {
+		enabled, ok := config.CollectorEnabled(c)
+		if !ok {
+			enabled = flagCollectorState[c]
+		}
+		*collectorState[c] = enabled
+	}
+	for _, c := range initiatedCollectors {
+		if p, ok := c.(*pollingCollector); ok {
+			p.Stop()
+		}
+	}
+	initiatedCollectors = make(map[string]Collector)
+	return nil
+}
+
 func NewJellyfinCollector(logger *slog.Logger, filters ...string) (*JellyfinCollector, error) {
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
 	f := make(map[string]bool)
 	for _, filter := range filters {
 		enabled, exist := collectorState[filter]
 		if !exist {
-			return nil, fmt.Errorf("missing collector: %s", filter)
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCollector, filter)
 		}
 		if !*enabled {
-			return nil, fmt.Errorf("disabled collector: %s", filter)
+			return nil, fmt.Errorf("%w: %s", ErrDisabledCollector, filter)
 		}
 		f[filter] = true
 	}
+	target, err := config.DefaultTarget(logger)
+	if errors.Is(err, config.ErrNoDefaultTarget) {
+		// Only /probe scrapes Jellyfin.
+		return &JellyfinCollector{Collectors: map[string]Collector{}, logger: logger}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	collectors := make(map[string]Collector)
-	initiatedCollectorsMtx.Lock()
-	defer initiatedCollectorsMtx.Unlock()
 	for key, enabled := range collectorState {
 		if !*enabled || (len(f) > 0 && !f[key]) {
 			continue
@@ -114,43 +209,115 @@ func NewJellyfinCollector(logger *slog.Logger, filters ...string) (*JellyfinColl
 		if collector, ok := initiatedCollectors[key]; ok {
 			collectors[key] = collector
 		} else {
-			collector, err := factories[key](logger.With("collector", key))
+			collector, err := factories[key](logger.With("collector", key), target)
 			if err != nil {
 				return nil, err
 			}
+			if interval := pollIntervalFor(key); interval > 0 {
+				collector = newPollingCollector(key, collector, interval, logger.With("collector", key))
+			}
 			collectors[key] = collector
 			initiatedCollectors[key] = collector
 		}
 	}
-	return &JellyfinCollector{Collectors: collectors, logger: logger}, nil
+	return &JellyfinCollector{Collectors: collectors, Target: target.URL, logger: logger}, nil
+}
+
+// NewJellyfinProbeCollector creates a JellyfinCollector bound to target.
+// Collectors are built fresh for every call and are not cached, so collectors
+// that keep state between scrapes are left out.
+func NewJellyfinProbeCollector(logger *slog.Logger, target config.Target) (*JellyfinCollector, error) {
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
+	collectors := make(map[string]Collector)
+	for key, enabled := range collectorState {
+		if !*enabled || probeExcluded[key] {
+			continue
+		}
+		collector, err := factories[key](logger.With("collector", key), target)
+		if err != nil {
+			return nil, err
+		}
+		collectors[key] = collector
+	}
+	return &JellyfinCollector{Collectors: collectors, Target: target.URL, logger: logger}, nil
+}
+
+// WithContext returns a copy of n whose collectors run with ctx, so that a
+// scrape stops once the request it belongs to is cancelled.
+func (n JellyfinCollector) WithContext(ctx context.Context) *JellyfinCollector {
+	n.ctx = ctx
+	return &n
 }
 
 func (n JellyfinCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	ch <- scrapeTimeoutDesc
 }
 
 func (n JellyfinCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := n.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if privacy := newPrivacyFilter(n.logger); privacy != nil {
+		private := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func(out chan<- prometheus.Metric) {
+			privacy.forward(private, out)
+			close(done)
+		}(ch)
+		defer func() {
+			close(private)
+			<-done
+		}()
+		ch = private
+	}
 	wg := sync.WaitGroup{}
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
+			execute(ctx, name, c, ch, n.logger)
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
+func timeoutFor(name string) time.Duration {
+	if timeout, ok := config.CollectorTimeout(name); ok {
+		return timeout
+	}
+	return *collectorTimeout
+}
+
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric, logger *slog.Logger) {
+	collectorCtx := ctx
+	if timeout := timeoutFor(name); timeout > 0 {
+		var cancel context.CancelFunc
+		collectorCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	begin := time.Now()
-	err := c.Update(ch)
+	err := c.Update(collectorCtx, ch)
 	duration := time.Since(begin)
-	var success float64
+	var success, timedOut float64
+
+	// Only count the collector's own deadline, not a cancelled scrape.
+	if errors.Is(collectorCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		logger.Warn("collector timed out", "name", name, "duration_seconds", duration.Seconds())
+		timedOut = 1
+	}
 
 	if err != nil {
 		if IsNoDataError(err) {
 			logger.Debug("collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		} else if ctx.Err() != nil {
+			logger.Debug("collector cancelled with the scrape", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+		} else if utils.IsUnauthorized(err) {
+			logger.Error("collector failed, Jellyfin rejected the API token", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		} else {
 			logger.Error("collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		}
@@ -161,10 +328,11 @@ func execute(name string, c Collector, ch chan<- prometheus.Metric, logger *slog
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timedOut, name)
 }
 
 type Collector interface {
-	Update(ch chan<- prometheus.Metric) error
+	Update(ctx context.Context, ch chan<- prometheus.Metric) error
 }
 
 type typedDesc struct {
@@ -178,10 +346,42 @@ func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) promethe
 
 var ErrNoData = errors.New("collector returned no data")
 
+var (
+	// ErrUnknownCollector is returned when a filter names a collector that
+	// doesn't exist.
+	ErrUnknownCollector = errors.New("missing collector")
+	// ErrDisabledCollector is returned when a filter names a collector that
+	// isn't enabled.
+	ErrDisabledCollector = errors.New("disabled collector")
+)
+
+// IsKnownCollector reports whether a collector with the given name exists.
+func IsKnownCollector(name string) bool {
+	_, ok := factories[name]
+	return ok
+}
+
 func IsNoDataError(err error) bool {
 	return err == ErrNoData
 }
 
+// parseJellyfinTime parses a date from the Jellyfin API. Jellyfin omits the
+// zone for some UTC dates.
+func parseJellyfinTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Parse("2006-01-02T15:04:05.999999999", value)
+	}
+	return t, nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func pushMetric(ch chan<- prometheus.Metric, fieldDesc *prometheus.Desc, name string, value interface{}, valueType prometheus.ValueType, labelValues ...string) {
 	var fVal float64
 	switch val := value.(type) {
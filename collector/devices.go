@@ -0,0 +1,124 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nodevices
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+type JellyfinDevice struct {
+	Id               string `json:"Id"`
+	Name             string `json:"Name"`
+	LastUserName     string `json:"LastUserName"`
+	AppName          string `json:"AppName"`
+	AppVersion       string `json:"AppVersion"`
+	DateLastActivity string `json:"DateLastActivity"`
+}
+
+type JellyfinDevices struct {
+	Items []JellyfinDevice `json:"Items"`
+}
+
+type deviceKey struct {
+	app     string
+	version string
+}
+
+type devicesCollector struct {
+	deviceInfo   *prometheus.Desc
+	lastActivity *prometheus.Desc
+	appCount     *prometheus.Desc
+	userCount    *prometheus.Desc
+	client       *utils.Client
+	logger       *slog.Logger
+}
+
+func init() {
+	registerCollector("devices", defaultEnabled, NewDevicesCollector)
+}
+
+func NewDevicesCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "device"
+	deviceInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "info"),
+		"Jellyfin registered devices.",
+		[]string{"device_id", "device", "username", "app", "app_version"}, nil,
+	)
+	lastActivity := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "last_activity_timestamp_seconds"),
+		"Time a registered device was last active.",
+		[]string{"device_id", "device"}, nil,
+	)
+	appCount := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "app_count"),
+		"Number of registered devices by client app and version.",
+		[]string{"app", "app_version"}, nil,
+	)
+	userCount := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "user_count"),
+		"Number of registered devices by last user.",
+		[]string{"username"}, nil,
+	)
+	return &devicesCollector{
+		deviceInfo:   deviceInfo,
+		lastActivity: lastActivity,
+		appCount:     appCount,
+		userCount:    userCount,
+		client:       utils.NewClient(target),
+		logger:       logger,
+	}, nil
+}
+
+func getDevices(ctx context.Context, client *utils.Client) ([]JellyfinDevice, error) {
+	var devices JellyfinDevices
+	if err := client.Get(ctx, "/Devices", &devices); err != nil {
+		return nil, err
+	}
+	return devices.Items, nil
+}
+
+func (c *devicesCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	devices, err := getDevices(ctx, c.client)
+	if err != nil {
+		c.logger.Error("Failed to get devices", "error", err)
+		return err
+	}
+	apps := make(map[deviceKey]int)
+	users := make(map[string]int)
+	for _, device := range devices {
+		c.logger.Debug("Jellyfin device", "Name", device.Name, "App", device.AppName, "User", device.LastUserName)
+		ch <- prometheus.MustNewConstMetric(c.deviceInfo, prometheus.GaugeValue, 1,
+			device.Id, device.Name, device.LastUserName, device.AppName, device.AppVersion)
+		if lastActivity, err := parseJellyfinTime(device.DateLastActivity); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.lastActivity, prometheus.GaugeValue, float64(lastActivity.Unix()), device.Id, device.Name)
+		}
+		apps[deviceKey{app: device.AppName, version: device.AppVersion}]++
+		users[device.LastUserName]++
+	}
+	for key, count := range apps {
+		ch <- prometheus.MustNewConstMetric(c.appCount, prometheus.GaugeValue, float64(count), key.app, key.version)
+	}
+	for username, count := range users {
+		ch <- prometheus.MustNewConstMetric(c.userCount, prometheus.GaugeValue, float64(count), username)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	geoipCountryDB = kingpin.Flag("collector.sessions.geoip-country-db", "Path to a MaxMind format country or city database (.mmdb) used to add the country of remote sessions.").PlaceHolder("FILE").String()
+	geoipASNDB     = kingpin.Flag("collector.sessions.geoip-asn-db", "Path to a MaxMind format ASN database (.mmdb) used to add the autonomous system of remote sessions.").PlaceHolder("FILE").String()
+	lanNetworks    = networkListFlag(kingpin.Flag("collector.sessions.lan-networks", "Comma separated networks whose sessions are reported as network=\"lan\".").Default("10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,127.0.0.0/8,169.254.0.0/16,::1/128,fc00::/7,fe80::/10"))
+	networkLabel   = kingpin.Flag("collector.sessions.network-label", "Add a network label, lan or wan, to active users and playing sessions.").Default("false").Bool()
+)
+
+// networkList is a comma separated list of networks. Invalid networks are
+// rejected when the flags are parsed.
+type networkList []netip.Prefix
+
+func networkListFlag(s kingpin.Settings) *networkList {
+	l := &networkList{}
+	s.SetValue(l)
+	return l
+}
+
+func (l *networkList) Set(value string) error {
+	prefixes, err := parseNetworks(strings.Split(value, ","))
+	if err != nil {
+		return fmt.Errorf("invalid network: %w", err)
+	}
+	*l = prefixes
+	return nil
+}
+
+func (l *networkList) String() string {
+	networks := make([]string, 0, len(*l))
+	for _, prefix := range *l {
+		networks = append(networks, prefix.String())
+	}
+	return strings.Join(networks, ",")
+}
+
+func parseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(network))
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// locationLabels returns the location labels added to active users and
+// playing sessions. Each label is only added when it is enabled, so that
+// existing series keep their labels.
+func locationLabels() []string {
+	labels := []string{}
+	if *geoipCountryDB != "" {
+		labels = append(labels, "country")
+	}
+	if *geoipASNDB != "" {
+		labels = append(labels, "asn")
+	}
+	if *networkLabel {
+		labels = append(labels, "network")
+	}
+	return labels
+}
+
+type geoipCountryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+type geoipASNRecord struct {
+	AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+}
+
+var (
+	geoipOnce      sync.Once
+	geoipCountries *maxminddb.Reader
+	geoipASNs      *maxminddb.Reader
+)
+
+func openGeoIPDatabases(logger *slog.Logger) {
+	geoipOnce.Do(func() {
+		var err error
+		if *geoipCountryDB != "" {
+			if geoipCountries, err = maxminddb.Open(*geoipCountryDB); err != nil {
+				logger.Error("Couldn't open GeoIP country database, sessions have no country", "file", *geoipCountryDB, "err", err)
+			}
+		}
+		if *geoipASNDB != "" {
+			if geoipASNs, err = maxminddb.Open(*geoipASNDB); err != nil {
+				logger.Error("Couldn't open GeoIP ASN database, sessions have no ASN", "file", *geoipASNDB, "err", err)
+			}
+		}
+	})
+}
+
+// sessionLocator classifies the remote address of sessions. Lookups only use
+// the local GeoIP databases.
+type sessionLocator struct {
+	lan    []netip.Prefix
+	logger *slog.Logger
+}
+
+func newSessionLocator(logger *slog.Logger) sessionLocator {
+	openGeoIPDatabases(logger)
+	l := sessionLocator{lan: *lanNetworks, logger: logger}
+	if networks := config.Sessions().LANNetworks; len(networks) > 0 {
+		// The config file was validated when it was loaded.
+		l.lan, _ = parseNetworks(networks)
+	}
+	return l
+}
+
+// locate returns the values of locationLabels for remoteEndPoint. Country
+// and ASN are empty when they can't be determined.
+func (l sessionLocator) locate(remoteEndPoint string) []string {
+	labels := locationLabels()
+	values := make([]string, 0, len(labels))
+	addr, ok := parseRemoteEndPoint(remoteEndPoint)
+	for _, label := range labels {
+		switch label {
+		case "country":
+			values = append(values, l.country(addr, ok))
+		case "asn":
+			values = append(values, l.asn(addr, ok))
+		case "network":
+			values = append(values, l.network(remoteEndPoint))
+		}
+	}
+	return values
+}
+
+func (l sessionLocator) country(addr netip.Addr, ok bool) string {
+	if !ok || geoipCountries == nil || l.isLAN(addr) {
+		return ""
+	}
+	var record geoipCountryRecord
+	if err := geoipCountries.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		l.logger.Debug("GeoIP country lookup failed", "address", addr, "err", err)
+	}
+	return record.Country.ISOCode
+}
+
+func (l sessionLocator) asn(addr netip.Addr, ok bool) string {
+	if !ok || geoipASNs == nil || l.isLAN(addr) {
+		return ""
+	}
+	var record geoipASNRecord
+	if err := geoipASNs.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		l.logger.Debug("GeoIP ASN lookup failed", "address", addr, "err", err)
+	}
+	if record.AutonomousSystemNumber == 0 {
+		return ""
+	}
+	return fmt.Sprintf("AS%d", record.AutonomousSystemNumber)
+}
+
+// network returns "lan" for sessions from a LAN network and "wan" for all
+// others, including those without a valid remote address.
+func (l sessionLocator) network(remoteEndPoint string) string {
+	if addr, ok := parseRemoteEndPoint(remoteEndPoint); ok && l.isLAN(addr) {
+		return "lan"
+	}
+	return "wan"
+}
+
+func (l sessionLocator) isLAN(addr netip.Addr) bool {
+	for _, prefix := range l.lan {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRemoteEndPoint(remoteEndPoint string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(remoteEndPoint)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(remoteEndPoint)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = addrPort.Addr()
+	}
+	return addr.Unmap(), true
+}
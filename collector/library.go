@@ -0,0 +1,188 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nolibrary
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// libraryItemTypes lists the item types counted for each collection type.
+// Libraries with an unknown or mixed collection type use the "" entry.
+var libraryItemTypes = map[string][]string{
+	"movies":      {"Movie"},
+	"tvshows":     {"Series", "Season", "Episode"},
+	"music":       {"MusicArtist", "MusicAlbum", "Audio"},
+	"musicvideos": {"MusicVideo"},
+	"books":       {"Book", "AudioBook"},
+	"homevideos":  {"Video", "Photo"},
+	"photos":      {"Photo", "Video"},
+	"boxsets":     {"BoxSet"},
+	"playlists":   {"Playlist"},
+	"":            {"Movie", "Series", "Episode", "Video"},
+}
+
+type JellyfinVirtualFolder struct {
+	Name            string   `json:"Name"`
+	Locations       []string `json:"Locations"`
+	CollectionType  string   `json:"CollectionType"`
+	ItemId          string   `json:"ItemId"`
+	RefreshProgress *float64 `json:"RefreshProgress"`
+	RefreshStatus   string   `json:"RefreshStatus"`
+}
+
+type JellyfinItemsResult struct {
+	TotalRecordCount float64 `json:"TotalRecordCount"`
+}
+
+type libraryCollector struct {
+	libraryInfo       *prometheus.Desc
+	libraryPaths      *prometheus.Desc
+	libraryRefreshing *prometheus.Desc
+	libraryProgress   *prometheus.Desc
+	libraryItems      *prometheus.Desc
+	itemTypes         []string
+	client            *utils.Client
+	logger            *slog.Logger
+}
+
+func init() {
+	registerCollector("library", defaultDisabled, NewLibraryCollector)
+	registerCollectorOptions("library", "item_types")
+}
+
+func NewLibraryCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "library"
+	libraryLabels := []string{"library_id", "library"}
+	libraryInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "info"),
+		"Jellyfin library information.",
+		[]string{"library_id", "library", "collection_type"}, nil,
+	)
+	libraryPaths := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "paths"),
+		"Jellyfin library folder count.",
+		libraryLabels, nil,
+	)
+	libraryRefreshing := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "refreshing"),
+		"Whether the Jellyfin library is being refreshed.",
+		libraryLabels, nil,
+	)
+	libraryProgress := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "refresh_progress_percent"),
+		"Jellyfin library refresh progress.",
+		libraryLabels, nil,
+	)
+	libraryItems := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "items"),
+		"Jellyfin library items by type.",
+		[]string{"library_id", "library", "type"}, nil,
+	)
+
+	var itemTypes []string
+	if option := config.CollectorOption("library", "item_types", ""); option != "" {
+		for _, t := range strings.Split(option, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				itemTypes = append(itemTypes, t)
+			}
+		}
+	}
+	return &libraryCollector{
+		libraryInfo:       libraryInfo,
+		libraryPaths:      libraryPaths,
+		libraryRefreshing: libraryRefreshing,
+		libraryProgress:   libraryProgress,
+		libraryItems:      libraryItems,
+		itemTypes:         itemTypes,
+		client:            utils.NewClient(target),
+		logger:            logger,
+	}, nil
+}
+
+func getVirtualFolders(ctx context.Context, client *utils.Client) ([]JellyfinVirtualFolder, error) {
+	var folders []JellyfinVirtualFolder
+	if err := client.Get(ctx, "/Library/VirtualFolders", &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func getLibraryItemCount(ctx context.Context, client *utils.Client, libraryID, itemType string) (float64, error) {
+	query := url.Values{}
+	query.Set("ParentId", libraryID)
+	query.Set("Recursive", "true")
+	query.Set("Limit", "0")
+	query.Set("IncludeItemTypes", itemType)
+	var result JellyfinItemsResult
+	if err := client.Get(ctx, "/Items?"+query.Encode(), &result); err != nil {
+		return 0, err
+	}
+	return result.TotalRecordCount, nil
+}
+
+func (c *libraryCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	folders, err := getVirtualFolders(ctx, c.client)
+	if err != nil {
+		c.logger.Error("Failed to get libraries", "error", err)
+		return err
+	}
+	var errs []error
+	for _, folder := range folders {
+		c.logger.Debug("Jellyfin library", "Name", folder.Name, "Type", folder.CollectionType)
+		ch <- prometheus.MustNewConstMetric(c.libraryInfo, prometheus.GaugeValue, 1,
+			folder.ItemId, folder.Name, folder.CollectionType)
+		ch <- prometheus.MustNewConstMetric(c.libraryPaths, prometheus.GaugeValue,
+			float64(len(folder.Locations)), folder.ItemId, folder.Name)
+		ch <- prometheus.MustNewConstMetric(c.libraryRefreshing, prometheus.GaugeValue,
+			boolToFloat(folder.RefreshStatus != "" && folder.RefreshStatus != "Idle"), folder.ItemId, folder.Name)
+		if folder.RefreshProgress != nil {
+			ch <- prometheus.MustNewConstMetric(c.libraryProgress, prometheus.GaugeValue,
+				*folder.RefreshProgress, folder.ItemId, folder.Name)
+		}
+
+		itemTypes := c.itemTypes
+		if itemTypes == nil {
+			var ok bool
+			if itemTypes, ok = libraryItemTypes[folder.CollectionType]; !ok {
+				itemTypes = libraryItemTypes[""]
+			}
+		}
+		for _, itemType := range itemTypes {
+			if ctx.Err() != nil {
+				// The scrape is over, further requests would fail as well.
+				return errors.Join(append(errs, ctx.Err())...)
+			}
+			count, err := getLibraryItemCount(ctx, c.client, folder.ItemId, itemType)
+			if err != nil {
+				c.logger.Error("Failed to get library item count", "library", folder.Name, "type", itemType, "error", err)
+				errs = append(errs, err)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.libraryItems, prometheus.GaugeValue,
+				count, folder.ItemId, folder.Name, itemType)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,285 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nolivetv
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	liveTvServiceStatuses = []string{"Ok", "Unavailable"}
+	liveTvTimerStatuses   = []string{"New", "InProgress", "Completed", "Cancelled", "ConflictedOk", "ConflictedNotOk", "Error"}
+)
+
+type LiveTvService struct {
+	Name          string   `json:"Name"`
+	Status        string   `json:"Status"`
+	StatusMessage string   `json:"StatusMessage"`
+	Version       string   `json:"Version"`
+	Tuners        []string `json:"Tuners"`
+}
+
+type LiveTvInfo struct {
+	Services  []LiveTvService `json:"Services"`
+	IsEnabled bool            `json:"IsEnabled"`
+}
+
+type LiveTvTimer struct {
+	Id     string `json:"Id"`
+	Name   string `json:"Name"`
+	Status string `json:"Status"`
+}
+
+type LiveTvTimers struct {
+	Items []LiveTvTimer `json:"Items"`
+}
+
+// LiveTvSession is the part of a session that tells whether it watches a
+// Live TV channel.
+type LiveTvSession struct {
+	NowPlayingItem *struct {
+		Type string `json:"Type"`
+	} `json:"NowPlayingItem"`
+}
+
+type LiveTvCount struct {
+	TotalRecordCount int64 `json:"TotalRecordCount"`
+}
+
+type LiveTvGuideInfo struct {
+	StartDate string `json:"StartDate"`
+	EndDate   string `json:"EndDate"`
+}
+
+type liveTvCollector struct {
+	enabled       *prometheus.Desc
+	serviceStatus *prometheus.Desc
+	serviceTuners *prometheus.Desc
+	tunersInUse   *prometheus.Desc
+	timers        *prometheus.Desc
+	recordings    *prometheus.Desc
+	seriesTimers  *prometheus.Desc
+	guideStart    *prometheus.Desc
+	guideEnd      *prometheus.Desc
+	client        *utils.Client
+	logger        *slog.Logger
+}
+
+func init() {
+	registerCollector("livetv", defaultDisabled, NewLiveTvCollector)
+}
+
+func NewLiveTvCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "livetv"
+	enabled := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "enabled"),
+		"Whether Live TV is enabled on the Jellyfin server.",
+		nil, nil,
+	)
+	serviceStatus := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_status"),
+		"Status of a Live TV service, such as the built-in tuner service. Jellyfin doesn't report the status of single tuner hosts.",
+		[]string{"service", "status"}, nil,
+	)
+	serviceTuners := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_tuners"),
+		"Number of tuner hosts configured for a Live TV service.",
+		[]string{"service"}, nil,
+	)
+	tunersInUse := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "tuners_in_use"),
+		"Number of tuners used by recordings in progress and sessions watching a Live TV channel.",
+		nil, nil,
+	)
+	timers := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "timers"),
+		"Number of recording timers by status.",
+		[]string{"status"}, nil,
+	)
+	recordings := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "recordings"),
+		"Number of recordings.",
+		nil, nil,
+	)
+	seriesTimers := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "series_timers"),
+		"Number of series recording timers.",
+		nil, nil,
+	)
+	guideStart := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "guide_start_timestamp_seconds"),
+		"Start of the guide data.",
+		nil, nil,
+	)
+	guideEnd := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "guide_end_timestamp_seconds"),
+		"End of the guide data.",
+		nil, nil,
+	)
+	return &liveTvCollector{
+		enabled:       enabled,
+		serviceStatus: serviceStatus,
+		serviceTuners: serviceTuners,
+		tunersInUse:   tunersInUse,
+		timers:        timers,
+		recordings:    recordings,
+		seriesTimers:  seriesTimers,
+		guideStart:    guideStart,
+		guideEnd:      guideEnd,
+		client:        utils.NewClient(target),
+		logger:        logger,
+	}, nil
+}
+
+func getLiveTvInfo(ctx context.Context, client *utils.Client) (LiveTvInfo, error) {
+	var info LiveTvInfo
+	if err := client.Get(ctx, "/LiveTv/Info", &info); err != nil {
+		return LiveTvInfo{}, err
+	}
+	return info, nil
+}
+
+func getLiveTvTimers(ctx context.Context, client *utils.Client) ([]LiveTvTimer, error) {
+	var timers LiveTvTimers
+	if err := client.Get(ctx, "/LiveTv/Timers", &timers); err != nil {
+		return nil, err
+	}
+	return timers.Items, nil
+}
+
+// getLiveTvViewers returns the number of sessions watching a Live TV channel.
+func getLiveTvViewers(ctx context.Context, client *utils.Client) (int, error) {
+	var sessions []LiveTvSession
+	if err := client.Get(ctx, "/Sessions?IsPlaying=true", &sessions); err != nil {
+		return 0, err
+	}
+	viewers := 0
+	for _, session := range sessions {
+		if session.NowPlayingItem != nil && session.NowPlayingItem.Type == "TvChannel" {
+			viewers++
+		}
+	}
+	return viewers, nil
+}
+
+func getLiveTvCount(ctx context.Context, client *utils.Client, path string) (int64, error) {
+	var count LiveTvCount
+	if err := client.Get(ctx, path, &count); err != nil {
+		return 0, err
+	}
+	return count.TotalRecordCount, nil
+}
+
+func getLiveTvGuideInfo(ctx context.Context, client *utils.Client) (LiveTvGuideInfo, error) {
+	var guide LiveTvGuideInfo
+	if err := client.Get(ctx, "/LiveTv/GuideInfo", &guide); err != nil {
+		return LiveTvGuideInfo{}, err
+	}
+	return guide, nil
+}
+
+func (c *liveTvCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	info, infoErr := getLiveTvInfo(ctx, c.client)
+	if infoErr != nil {
+		if ctx.Err() != nil {
+			// The scrape is over, further requests would fail as well.
+			return infoErr
+		}
+		c.logger.Error("Failed to get Live TV info", "error", infoErr)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue, boolToFloat(info.IsEnabled))
+		for _, service := range info.Services {
+			c.logger.Debug("Jellyfin Live TV service", "Name", service.Name, "Status", service.Status, "StatusMessage", service.StatusMessage)
+			for _, status := range liveTvServiceStatuses {
+				ch <- prometheus.MustNewConstMetric(c.serviceStatus, prometheus.GaugeValue,
+					boolToFloat(service.Status == status), service.Name, status)
+			}
+			ch <- prometheus.MustNewConstMetric(c.serviceTuners, prometheus.GaugeValue, float64(len(service.Tuners)), service.Name)
+		}
+	}
+
+	var viewersErr error
+	timers, timersErr := getLiveTvTimers(ctx, c.client)
+	if timersErr != nil {
+		if ctx.Err() != nil {
+			return errors.Join(infoErr, timersErr)
+		}
+		c.logger.Error("Failed to get Live TV timers", "error", timersErr)
+	} else {
+		statuses := make(map[string]int)
+		for _, status := range liveTvTimerStatuses {
+			statuses[status] = 0
+		}
+		for _, timer := range timers {
+			statuses[timer.Status]++
+		}
+		for status, count := range statuses {
+			ch <- prometheus.MustNewConstMetric(c.timers, prometheus.GaugeValue, float64(count), status)
+		}
+
+		var viewers int
+		viewers, viewersErr = getLiveTvViewers(ctx, c.client)
+		if viewersErr != nil {
+			if ctx.Err() != nil {
+				return errors.Join(infoErr, viewersErr)
+			}
+			c.logger.Error("Failed to get Live TV sessions", "error", viewersErr)
+		} else {
+			ch <- prometheus.MustNewConstMetric(c.tunersInUse, prometheus.GaugeValue, float64(statuses["InProgress"]+viewers))
+		}
+	}
+
+	recordings, recordingsErr := getLiveTvCount(ctx, c.client, "/LiveTv/Recordings?Limit=0")
+	if recordingsErr != nil {
+		if ctx.Err() != nil {
+			return errors.Join(infoErr, timersErr, viewersErr, recordingsErr)
+		}
+		c.logger.Error("Failed to get Live TV recordings", "error", recordingsErr)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.recordings, prometheus.GaugeValue, float64(recordings))
+	}
+
+	seriesTimers, seriesErr := getLiveTvCount(ctx, c.client, "/LiveTv/SeriesTimers")
+	if seriesErr != nil {
+		if ctx.Err() != nil {
+			return errors.Join(infoErr, timersErr, viewersErr, recordingsErr, seriesErr)
+		}
+		c.logger.Error("Failed to get Live TV series timers", "error", seriesErr)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.seriesTimers, prometheus.GaugeValue, float64(seriesTimers))
+	}
+
+	guide, guideErr := getLiveTvGuideInfo(ctx, c.client)
+	if guideErr != nil {
+		c.logger.Error("Failed to get Live TV guide info", "error", guideErr)
+	} else {
+		if start, err := parseJellyfinTime(guide.StartDate); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.guideStart, prometheus.GaugeValue, float64(start.Unix()))
+		}
+		if end, err := parseJellyfinTime(guide.EndDate); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.guideEnd, prometheus.GaugeValue, float64(end.Unix()))
+		}
+	}
+
+	return errors.Join(infoErr, timersErr, viewersErr, recordingsErr, seriesErr, guideErr)
+}
@@ -16,8 +16,7 @@
 package collector
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"log/slog"
 	"strings"
 
@@ -29,6 +28,7 @@ import (
 
 type mediaCollector struct {
 	mediaItems *prometheus.Desc
+	client     *utils.Client
 	logger     *slog.Logger
 }
 
@@ -36,7 +36,7 @@ func init() {
 	registerCollector("media", defaultEnabled, NewMediaCollector)
 }
 
-func NewMediaCollector(logger *slog.Logger) (Collector, error) {
+func NewMediaCollector(logger *slog.Logger, target config.Target) (Collector, error) {
 	const subsystem = "media"
 	mediaItems := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "count"),
@@ -45,31 +45,21 @@ func NewMediaCollector(logger *slog.Logger) (Collector, error) {
 	)
 	return &mediaCollector{
 		mediaItems: mediaItems,
+		client:     utils.NewClient(target),
 		logger:     logger,
 	}, nil
 }
 
-func getMediaCounts(jellyfinURL, jellyfinToken string) (map[string]float64, error) {
-	jellyfinAPIURL := fmt.Sprintf("%s/Items/Counts", jellyfinURL)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
-	rawBody, err := utils.CoerceToJSONBytes(rawData)
-	if err != nil {
-		return nil, err
-	}
+func getMediaCounts(ctx context.Context, client *utils.Client) (map[string]float64, error) {
 	var counts map[string]float64
-	if err := json.Unmarshal(rawBody, &counts); err != nil {
-		return nil, fmt.Errorf("unexpected response from Jellyfin API: %w", err)
+	if err := client.Get(ctx, "/Items/Counts", &counts); err != nil {
+		return nil, err
 	}
 	return counts, nil
 }
 
-func (c *mediaCollector) Update(ch chan<- prometheus.Metric) error {
-	jellyfinURL, jellyfinToken, err := config.JellyfinInfo(c.logger)
-	if err != nil {
-		c.logger.Error("Failed to get Jellyfin config", "error", err)
-		return err
-	}
-	counts, err := getMediaCounts(jellyfinURL, jellyfinToken)
+func (c *mediaCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	counts, err := getMediaCounts(ctx, c.client)
 	if err != nil {
 		c.logger.Error("Failed to get media counts", "error", err)
 		return err
@@ -16,9 +16,11 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -32,84 +34,323 @@ type PlayState struct {
 	CanSeek             bool   `json:"CanSeek"`
 	IsPaused            bool   `json:"IsPaused"`
 	IsMuted             bool   `json:"IsMuted"`
-	AudioStreamIndex    int    `json:"AudioStreamIndex"`
-	SubtitleStreamIndex int    `json:"SubtitleStreamIndex"`
+	AudioStreamIndex    *int   `json:"AudioStreamIndex"`
+	SubtitleStreamIndex *int   `json:"SubtitleStreamIndex"`
 	MediaSourceId       string `json:"MediaSourceId"`
 	PlayMethod          string `json:"PlayMethod"`
 	RepeatMode          string `json:"RepeatMode"`
 	PlaybackOrder       string `json:"PlaybackOrder"`
 }
 
+// ticksPerSecond is the resolution of Jellyfin tick values.
+const ticksPerSecond = 10_000_000
+
+type MediaSource struct {
+	Id        string `json:"Id"`
+	Container string `json:"Container"`
+	Bitrate   *int64 `json:"Bitrate"`
+}
+
+type MediaStream struct {
+	Type           string `json:"Type"`
+	Index          int    `json:"Index"`
+	Codec          string `json:"Codec"`
+	Width          int    `json:"Width"`
+	Height         int    `json:"Height"`
+	VideoRange     string `json:"VideoRange"`
+	VideoRangeType string `json:"VideoRangeType"`
+	ChannelLayout  string `json:"ChannelLayout"`
+	Channels       int    `json:"Channels"`
+	IsDefault      bool   `json:"IsDefault"`
+	DeliveryMethod string `json:"DeliveryMethod"`
+	BitRate        *int64 `json:"BitRate"`
+}
+
 type NowPlayingItem struct {
-	Name        string `json:"Name"`
-	Type        string `json:"Type"`
-	SeriesName  string `json:"SeriesName,omitempty"`
-	ParentIndex int    `json:"ParentIndexNumber,omitempty"`
-	IndexNumber int    `json:"IndexNumber,omitempty"`
+	Name         string        `json:"Name"`
+	Type         string        `json:"Type"`
+	RunTimeTicks int64         `json:"RunTimeTicks"`
+	SeriesName   string        `json:"SeriesName,omitempty"`
+	ParentIndex  int           `json:"ParentIndexNumber,omitempty"`
+	IndexNumber  int           `json:"IndexNumber,omitempty"`
+	Container    string        `json:"Container"`
+	MediaSources []MediaSource `json:"MediaSources"`
+	MediaStreams []MediaStream `json:"MediaStreams"`
+}
+
+// resolutionClass groups a video resolution into SD, 720p, 1080p or 4K. The
+// width is checked as well so that cropped widescreen video keeps its class.
+func resolutionClass(width, height int) string {
+	switch {
+	case width >= 3200 || height >= 1800:
+		return "4K"
+	case width >= 1800 || height >= 1000:
+		return "1080p"
+	case width >= 1200 || height >= 700:
+		return "720p"
+	case width > 0 || height > 0:
+		return "SD"
+	}
+	return ""
+}
+
+// selectedStream returns the stream of streamType with the given index, or,
+// when index is nil, the default or first stream of that type.
+func selectedStream(streams []MediaStream, streamType string, index *int) *MediaStream {
+	var fallback *MediaStream
+	for i := range streams {
+		stream := &streams[i]
+		if stream.Type != streamType {
+			continue
+		}
+		if index != nil {
+			if stream.Index == *index {
+				return stream
+			}
+			continue
+		}
+		if stream.IsDefault {
+			return stream
+		}
+		if fallback == nil {
+			fallback = stream
+		}
+	}
+	return fallback
+}
+
+// TranscodeReasons accepts both the array and the comma separated string
+// form that Jellyfin versions use for TranscodingInfo.TranscodeReasons.
+type TranscodeReasons []string
+
+func (r *TranscodeReasons) UnmarshalJSON(data []byte) error {
+	var reasons []string
+	if err := json.Unmarshal(data, &reasons); err == nil {
+		*r = reasons
+		return nil
+	}
+	var flags string
+	if err := json.Unmarshal(data, &flags); err != nil {
+		return err
+	}
+	*r = nil
+	for _, reason := range strings.Split(flags, ",") {
+		if reason = strings.TrimSpace(reason); reason != "" {
+			*r = append(*r, reason)
+		}
+	}
+	return nil
+}
+
+type TranscodingInfo struct {
+	AudioCodec               string           `json:"AudioCodec"`
+	VideoCodec               string           `json:"VideoCodec"`
+	Container                string           `json:"Container"`
+	IsVideoDirect            bool             `json:"IsVideoDirect"`
+	IsAudioDirect            bool             `json:"IsAudioDirect"`
+	Bitrate                  *int64           `json:"Bitrate"`
+	Framerate                *float64         `json:"Framerate"`
+	CompletionPercentage     *float64         `json:"CompletionPercentage"`
+	Width                    *int64           `json:"Width"`
+	Height                   *int64           `json:"Height"`
+	AudioChannels            *int64           `json:"AudioChannels"`
+	HardwareAccelerationType string           `json:"HardwareAccelerationType"`
+	TranscodeReasons         TranscodeReasons `json:"TranscodeReasons"`
 }
 
 type JellyfinSession struct {
-	PlayState          *PlayState      `json:"PlayState"`
-	UserId             string          `json:"UserId"`
-	UserName           string          `json:"UserName"`
-	DeviceName         string          `json:"DeviceName"`
-	Client             string          `json:"Client"`
-	ApplicationVersion string          `json:"ApplicationVersion"`
-	RemoteEndPoint     string          `json:"RemoteEndPoint"`
-	LastActivityDate   string          `json:"LastActivityDate"`
-	NowPlayingItem     *NowPlayingItem `json:"NowPlayingItem"`
+	Id                 string           `json:"Id"`
+	PlayState          *PlayState       `json:"PlayState"`
+	UserId             string           `json:"UserId"`
+	UserName           string           `json:"UserName"`
+	DeviceName         string           `json:"DeviceName"`
+	DeviceId           string           `json:"DeviceId"`
+	Client             string           `json:"Client"`
+	ApplicationVersion string           `json:"ApplicationVersion"`
+	RemoteEndPoint     string           `json:"RemoteEndPoint"`
+	LastActivityDate   string           `json:"LastActivityDate"`
+	NowPlayingItem     *NowPlayingItem  `json:"NowPlayingItem"`
+	TranscodingInfo    *TranscodingInfo `json:"TranscodingInfo"`
+}
+
+var sessionLabels = []string{"session_id", "user_id", "username", "device"}
+
+func sessionLabelValues(session JellyfinSession, extra ...string) []string {
+	return append([]string{session.Id, session.UserId, session.UserName, session.DeviceName}, extra...)
+}
+
+// sessionBitrate returns the bitrate streamed to a session: the transcoding
+// bitrate when transcoding, otherwise the bitrate of the played media source.
+// Sessions usually come without media sources, then the bitrates of the
+// selected video and audio streams are added up.
+func sessionBitrate(session JellyfinSession) (int64, bool) {
+	if info := session.TranscodingInfo; info != nil && info.Bitrate != nil && *info.Bitrate > 0 {
+		return *info.Bitrate, true
+	}
+	if session.NowPlayingItem == nil {
+		return 0, false
+	}
+	sourceID := ""
+	if session.PlayState != nil {
+		sourceID = session.PlayState.MediaSourceId
+	}
+	for _, source := range session.NowPlayingItem.MediaSources {
+		if source.Bitrate != nil && (sourceID == "" || source.Id == sourceID) {
+			return *source.Bitrate, true
+		}
+	}
+
+	var audioIndex *int
+	if session.PlayState != nil {
+		audioIndex = session.PlayState.AudioStreamIndex
+	}
+	var bitrate int64
+	found := false
+	for _, stream := range []*MediaStream{
+		selectedStream(session.NowPlayingItem.MediaStreams, "Video", nil),
+		selectedStream(session.NowPlayingItem.MediaStreams, "Audio", audioIndex),
+	} {
+		if stream != nil && stream.BitRate != nil && *stream.BitRate > 0 {
+			bitrate += *stream.BitRate
+			found = true
+		}
+	}
+	return bitrate, found
 }
 
 type playingCollector struct {
-	nowPlaying *prometheus.Desc
-	logger     *slog.Logger
+	nowPlaying          *prometheus.Desc
+	transcodeInfo       *prometheus.Desc
+	transcodeReason     *prometheus.Desc
+	transcodeBitrate    *prometheus.Desc
+	transcodeFramerate  *prometheus.Desc
+	transcodeCompletion *prometheus.Desc
+	position            *prometheus.Desc
+	runtime             *prometheus.Desc
+	progress            *prometheus.Desc
+	sessionCount        *prometheus.Desc
+	bitrate             *prometheus.Desc
+	outboundBitrate     *prometheus.Desc
+	mediaInfo           *prometheus.Desc
+	client              *utils.Client
+	logger              *slog.Logger
 }
 
 func init() {
 	registerCollector("playing", defaultEnabled, NewPlayingCollector)
 }
 
-func NewPlayingCollector(logger *slog.Logger) (Collector, error) {
+func NewPlayingCollector(logger *slog.Logger, target config.Target) (Collector, error) {
 	const subsystem = "now_playing"
 	nowPlaying := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "state"),
 		"Jellyfin currently playing sessions.",
-		[]string{
+		append([]string{
 			"user_id", "username", "device", "type", "title", "series_title", "series_season", "series_episode", "method",
-		}, nil,
+		}, locationLabels()...), nil,
+	)
+	transcodeInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "transcode_info"),
+		"Jellyfin transcoding details of a playing session.",
+		append(sessionLabels, "container", "video_codec", "audio_codec", "hw_accel", "video_direct", "audio_direct"), nil,
+	)
+	transcodeReason := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "transcode_reason"),
+		"Jellyfin reasons a playing session is transcoded.",
+		append(sessionLabels, "reason"), nil,
+	)
+	transcodeBitrate := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "transcode_bitrate_bps"),
+		"Jellyfin transcoding bitrate of a playing session.",
+		sessionLabels, nil,
+	)
+	transcodeFramerate := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "transcode_framerate"),
+		"Jellyfin transcoding framerate of a playing session.",
+		sessionLabels, nil,
+	)
+	transcodeCompletion := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "transcode_completion_percent"),
+		"Jellyfin transcoding completion of a playing session.",
+		sessionLabels, nil,
+	)
+	position := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "position_seconds"),
+		"Jellyfin playback position of a playing session.",
+		sessionLabels, nil,
+	)
+	runtime := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "runtime_seconds"),
+		"Jellyfin runtime of the item played in a session.",
+		sessionLabels, nil,
+	)
+	progress := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "progress_ratio"),
+		"Jellyfin playback progress of a playing session, from 0 to 1.",
+		sessionLabels, nil,
+	)
+	sessionCount := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "sessions"),
+		"Jellyfin playing sessions by state.",
+		[]string{"state"}, nil,
+	)
+	bitrate := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "bitrate_bps"),
+		"Jellyfin bitrate streamed to a playing session.",
+		append(sessionLabels, "network"), nil,
+	)
+	outboundBitrate := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "outbound_bitrate_bps"),
+		"Jellyfin total bitrate streamed to sessions that aren't paused, by network.",
+		[]string{"network"}, nil,
+	)
+	mediaInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "media_info"),
+		"Jellyfin media streams of the item played in a session.",
+		append(sessionLabels, "resolution", "video_codec", "hdr", "container", "audio_codec", "audio_channels", "subtitle_delivery"), nil,
 	)
 	return &playingCollector{
-		nowPlaying: nowPlaying,
-		logger:     logger,
+		nowPlaying:          nowPlaying,
+		transcodeInfo:       transcodeInfo,
+		transcodeReason:     transcodeReason,
+		transcodeBitrate:    transcodeBitrate,
+		transcodeFramerate:  transcodeFramerate,
+		transcodeCompletion: transcodeCompletion,
+		position:            position,
+		runtime:             runtime,
+		progress:            progress,
+		sessionCount:        sessionCount,
+		bitrate:             bitrate,
+		outboundBitrate:     outboundBitrate,
+		mediaInfo:           mediaInfo,
+		client:              utils.NewClient(target),
+		logger:              logger,
 	}, nil
 }
 
-func getNowPlayingSessions(jellyfinURL, jellyfinToken string) ([]JellyfinSession, error) {
-	jellyfinAPIURL := fmt.Sprintf("%s/Sessions?IsPlaying=true", jellyfinURL)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
-	rawBody, err := utils.CoerceToJSONBytes(rawData)
-	if err != nil {
-		return nil, err
-	}
+func getNowPlayingSessions(ctx context.Context, client *utils.Client) ([]JellyfinSession, error) {
 	var sessions []JellyfinSession
-	if err := json.Unmarshal(rawBody, &sessions); err != nil {
-		return nil, fmt.Errorf("unexpected response from Jellyfin API: %w", err)
+	if err := client.Get(ctx, "/Sessions?IsPlaying=true", &sessions); err != nil {
+		return nil, err
 	}
 	return sessions, nil
 }
 
-func (c *playingCollector) Update(ch chan<- prometheus.Metric) error {
-	jellyfinURL, jellyfinToken, err := config.JellyfinInfo(c.logger)
-	if err != nil {
-		c.logger.Error("Failed to get Jellyfin config", "error", err)
-		return err
-	}
-	sessions, err := getNowPlayingSessions(jellyfinURL, jellyfinToken)
+func (c *playingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	sessions, err := getNowPlayingSessions(ctx, c.client)
 	if err != nil {
 		c.logger.Error("Failed to get sessions", "error", err)
 		return err
 	}
+	playing, paused := 0, 0
+	filter := newSessionFilter()
+	locator := newSessionLocator(c.logger)
+	outbound := map[string]float64{"lan": 0, "wan": 0}
 	for _, session := range sessions {
+		if !filter.keep(session.Client, session.DeviceId, session.UserId) {
+			c.logger.Debug("Skipping filtered session", "Client", session.Client, "DeviceId", session.DeviceId)
+			continue
+		}
 		state := 1.0
 		playMethod := ""
 		mediaType := ""
@@ -136,10 +377,7 @@ func (c *playingCollector) Update(ch chan<- prometheus.Metric) error {
 			}
 		}
 		c.logger.Debug("Jellyfin Now Playing", "User", session.UserName, "Title", title)
-		ch <- prometheus.MustNewConstMetric(
-			c.nowPlaying,
-			prometheus.GaugeValue,
-			state,
+		labelValues := []string{
 			session.UserId,
 			session.UserName,
 			session.DeviceName,
@@ -149,7 +387,117 @@ func (c *playingCollector) Update(ch chan<- prometheus.Metric) error {
 			season,
 			episode,
 			playMethod,
-		)
+		}
+		labelValues = append(labelValues, locator.locate(session.RemoteEndPoint)...)
+		ch <- prometheus.MustNewConstMetric(c.nowPlaying, prometheus.GaugeValue, state, labelValues...)
+		if state == 1.0 {
+			playing++
+		} else {
+			paused++
+		}
+		if bitrate, ok := sessionBitrate(session); ok {
+			network := locator.network(session.RemoteEndPoint)
+			ch <- prometheus.MustNewConstMetric(c.bitrate, prometheus.GaugeValue, float64(bitrate), sessionLabelValues(session, network)...)
+			if state == 1.0 {
+				outbound[network] += float64(bitrate)
+			}
+		}
+		c.updateProgress(ch, session)
+		c.updateMediaInfo(ch, session)
+		if session.TranscodingInfo != nil {
+			c.updateTranscoding(ch, session)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.sessionCount, prometheus.GaugeValue, float64(playing), "playing")
+	ch <- prometheus.MustNewConstMetric(c.sessionCount, prometheus.GaugeValue, float64(paused), "paused")
+	for network, bitrate := range outbound {
+		ch <- prometheus.MustNewConstMetric(c.outboundBitrate, prometheus.GaugeValue, bitrate, network)
 	}
 	return nil
 }
+
+func (c *playingCollector) updateProgress(ch chan<- prometheus.Metric, session JellyfinSession) {
+	if session.PlayState == nil || session.NowPlayingItem == nil {
+		return
+	}
+	position := float64(session.PlayState.PositionTicks) / ticksPerSecond
+	runtime := float64(session.NowPlayingItem.RunTimeTicks) / ticksPerSecond
+	ch <- prometheus.MustNewConstMetric(c.position, prometheus.GaugeValue, position, sessionLabelValues(session)...)
+	if runtime > 0 {
+		ch <- prometheus.MustNewConstMetric(c.runtime, prometheus.GaugeValue, runtime, sessionLabelValues(session)...)
+		ch <- prometheus.MustNewConstMetric(c.progress, prometheus.GaugeValue, position/runtime, sessionLabelValues(session)...)
+	}
+}
+
+func (c *playingCollector) updateMediaInfo(ch chan<- prometheus.Metric, session JellyfinSession) {
+	item := session.NowPlayingItem
+	if item == nil || len(item.MediaStreams) == 0 {
+		return
+	}
+	var audioIndex, subtitleIndex *int
+	container := item.Container
+	if session.PlayState != nil {
+		audioIndex, subtitleIndex = session.PlayState.AudioStreamIndex, session.PlayState.SubtitleStreamIndex
+		for _, source := range item.MediaSources {
+			if source.Id == session.PlayState.MediaSourceId && source.Container != "" {
+				container = source.Container
+			}
+		}
+	}
+
+	resolution, videoCodec, hdr := "", "", ""
+	if video := selectedStream(item.MediaStreams, "Video", nil); video != nil {
+		resolution = resolutionClass(video.Width, video.Height)
+		videoCodec = video.Codec
+		hdr = video.VideoRangeType
+		if hdr == "" {
+			hdr = video.VideoRange
+		}
+	}
+	audioCodec, audioChannels := "", ""
+	if audio := selectedStream(item.MediaStreams, "Audio", audioIndex); audio != nil {
+		audioCodec = audio.Codec
+		audioChannels = audio.ChannelLayout
+		if audioChannels == "" && audio.Channels > 0 {
+			audioChannels = strconv.Itoa(audio.Channels)
+		}
+	}
+	// Without a selected index no subtitles are shown.
+	subtitleDelivery := ""
+	if subtitleIndex != nil {
+		if subtitle := selectedStream(item.MediaStreams, "Subtitle", subtitleIndex); subtitle != nil {
+			subtitleDelivery = subtitle.DeliveryMethod
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.mediaInfo, prometheus.GaugeValue, 1,
+		sessionLabelValues(session, resolution, videoCodec, hdr, container, audioCodec, audioChannels, subtitleDelivery)...)
+}
+
+func (c *playingCollector) updateTranscoding(ch chan<- prometheus.Metric, session JellyfinSession) {
+	info := session.TranscodingInfo
+	c.logger.Debug("Jellyfin Transcoding", "User", session.UserName, "Reasons", info.TranscodeReasons)
+	ch <- prometheus.MustNewConstMetric(
+		c.transcodeInfo,
+		prometheus.GaugeValue,
+		1,
+		sessionLabelValues(session,
+			info.Container,
+			info.VideoCodec,
+			info.AudioCodec,
+			info.HardwareAccelerationType,
+			strconv.FormatBool(info.IsVideoDirect),
+			strconv.FormatBool(info.IsAudioDirect),
+		)...,
+	)
+	for _, reason := range info.TranscodeReasons {
+		ch <- prometheus.MustNewConstMetric(c.transcodeReason, prometheus.GaugeValue, 1, sessionLabelValues(session, reason)...)
+	}
+	pushMetric(ch, c.transcodeBitrate, "transcode_bitrate_bps", info.Bitrate, prometheus.GaugeValue, sessionLabelValues(session)...)
+	if info.Framerate != nil {
+		ch <- prometheus.MustNewConstMetric(c.transcodeFramerate, prometheus.GaugeValue, *info.Framerate, sessionLabelValues(session)...)
+	}
+	if info.CompletionPercentage != nil {
+		ch <- prometheus.MustNewConstMetric(c.transcodeCompletion, prometheus.GaugeValue, *info.CompletionPercentage, sessionLabelValues(session)...)
+	}
+}
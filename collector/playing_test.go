@@ -0,0 +1,73 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noplaying
+
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSessionBitrate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		session string
+		want    int64
+		ok      bool
+	}{
+		{
+			name:    "transcoding",
+			session: `{"TranscodingInfo": {"Bitrate": 4000000}, "NowPlayingItem": {"MediaSources": [{"Bitrate": 9000000}]}}`,
+			want:    4000000,
+			ok:      true,
+		},
+		{
+			name:    "media source",
+			session: `{"PlayState": {"MediaSourceId": "b"}, "NowPlayingItem": {"MediaSources": [{"Id": "a", "Bitrate": 1}, {"Id": "b", "Bitrate": 9000000}]}}`,
+			want:    9000000,
+			ok:      true,
+		},
+		{
+			name: "selected streams",
+			session: `{"PlayState": {"AudioStreamIndex": 2}, "NowPlayingItem": {"MediaStreams": [
+				{"Type": "Video", "Index": 0, "BitRate": 8000000},
+				{"Type": "Audio", "Index": 1, "IsDefault": true, "BitRate": 640000},
+				{"Type": "Audio", "Index": 2, "BitRate": 192000},
+				{"Type": "Subtitle", "Index": 3, "BitRate": 100}
+			]}}`,
+			want: 8192000,
+			ok:   true,
+		},
+		{
+			name:    "no bitrate",
+			session: `{"NowPlayingItem": {"MediaStreams": [{"Type": "Video", "Index": 0}]}}`,
+		},
+		{
+			name:    "nothing playing",
+			session: `{}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var session JellyfinSession
+			if err := json.Unmarshal([]byte(tc.session), &session); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := sessionBitrate(session)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("got %d, %t, want %d, %t", got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noplugins
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+type JellyfinPlugin struct {
+	Name    string `json:"Name"`
+	Version string `json:"Version"`
+	Id      string `json:"Id"`
+	Status  string `json:"Status"`
+}
+
+type pluginsCollector struct {
+	pluginInfo     *prometheus.Desc
+	requirementMet *prometheus.Desc
+	required       map[string][]string
+	client         *utils.Client
+	logger         *slog.Logger
+}
+
+func init() {
+	registerCollector("plugins", defaultEnabled, NewPluginsCollector)
+}
+
+func NewPluginsCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "plugin"
+	pluginInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "info"),
+		"Jellyfin installed plugins.",
+		[]string{"name", "version", "id", "status"}, nil,
+	)
+	requirementMet := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "requirement_met"),
+		"Whether a plugin needed by an enabled collector is installed and active.",
+		[]string{"collector", "plugin"}, nil,
+	)
+	return &pluginsCollector{
+		pluginInfo:     pluginInfo,
+		requirementMet: requirementMet,
+		required:       enabledRequiredPlugins(),
+		client:         utils.NewClient(target),
+		logger:         logger,
+	}, nil
+}
+
+func getPlugins(ctx context.Context, client *utils.Client) ([]JellyfinPlugin, error) {
+	var plugins []JellyfinPlugin
+	if err := client.Get(ctx, "/Plugins", &plugins); err != nil {
+		return nil, err
+	}
+	return plugins, nil
+}
+
+func (c *pluginsCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	plugins, err := getPlugins(ctx, c.client)
+	if err != nil {
+		c.logger.Error("Failed to get plugins", "error", err)
+		return err
+	}
+	status := make(map[string]string)
+	for _, plugin := range plugins {
+		c.logger.Debug("Jellyfin plugin", "Name", plugin.Name, "Status", plugin.Status)
+		ch <- prometheus.MustNewConstMetric(c.pluginInfo, prometheus.GaugeValue, 1,
+			plugin.Name, plugin.Version, plugin.Id, plugin.Status)
+		status[strings.ToLower(plugin.Name)] = plugin.Status
+	}
+
+	for collector, names := range c.required {
+		for _, name := range names {
+			pluginStatus, installed := status[strings.ToLower(name)]
+			met := installed && pluginStatus == "Active"
+			if !met {
+				if !installed {
+					pluginStatus = "NotInstalled"
+				}
+				c.logger.Warn("Enabled collector needs a plugin that is not active", "collector", collector, "plugin", name, "status", pluginStatus)
+			}
+			ch <- prometheus.MustNewConstMetric(c.requirementMet, prometheus.GaugeValue, boolToFloat(met), collector, name)
+		}
+	}
+	return nil
+}
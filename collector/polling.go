@@ -0,0 +1,154 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	collectorPollInterval = kingpin.Flag("collector.poll-interval", "Refresh collectors in the background at this interval and serve the last snapshot on scrape. Use 0 to collect on every scrape.").Default("0s").Duration()
+)
+
+var (
+	lastSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "last_success_timestamp_seconds"),
+		"jellyfin_exporter: Time of the last successful background refresh of a collector.",
+		[]string{"collector"},
+		nil,
+	)
+	snapshotAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "snapshot_age_seconds"),
+		"jellyfin_exporter: Age of the metrics snapshot served for a collector.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+func pollIntervalFor(name string) time.Duration {
+	if interval, ok := config.CollectorPollInterval(name); ok {
+		return interval
+	}
+	return *collectorPollInterval
+}
+
+// pollingCollector runs a collector in the background and serves the metrics
+// of its last successful run. A failed run keeps the previous snapshot.
+type pollingCollector struct {
+	name      string
+	collector Collector
+	interval  time.Duration
+	logger    *slog.Logger
+
+	mtx         sync.RWMutex
+	metrics     []prometheus.Metric
+	err         error
+	lastSuccess time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPollingCollector(name string, c Collector, interval time.Duration, logger *slog.Logger) *pollingCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pollingCollector{
+		name:      name,
+		collector: c,
+		interval:  interval,
+		logger:    logger,
+		err:       ErrNoData,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go p.run(ctx)
+	return p
+}
+
+func (p *pollingCollector) run(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *pollingCollector) refresh(ctx context.Context) {
+	if timeout := timeoutFor(p.name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	metrics := []prometheus.Metric{}
+	ch := make(chan prometheus.Metric)
+	collected := make(chan struct{})
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(collected)
+	}()
+	begin := time.Now()
+	err := p.collector.Update(ctx, ch)
+	close(ch)
+	<-collected
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.logger.Warn("background refresh timed out", "name", p.name, "duration_seconds", time.Since(begin).Seconds())
+	}
+	p.logger.Debug("background refresh done", "name", p.name, "duration_seconds", time.Since(begin).Seconds(), "err", err)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.err = err
+	if err == nil {
+		p.metrics = metrics
+		p.lastSuccess = time.Now()
+	}
+}
+
+// Update sends the last snapshot and returns the error of the last refresh.
+func (p *pollingCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	for _, m := range p.metrics {
+		ch <- m
+	}
+	if !p.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(lastSuccessDesc, prometheus.GaugeValue, float64(p.lastSuccess.UnixNano())/1e9, p.name)
+		ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue, time.Since(p.lastSuccess).Seconds(), p.name)
+	}
+	return p.err
+}
+
+// Stop ends the background refresh and waits for a running one to finish.
+func (p *pollingCollector) Stop() {
+	p.cancel()
+	<-p.done
+}
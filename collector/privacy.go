@@ -0,0 +1,227 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// privacyFilter applies the privacy actions of the config file to the labels
+// of collected metrics.
+type privacyFilter struct {
+	salt    string
+	actions map[string]string
+	logger  *slog.Logger
+}
+
+// newPrivacyFilter returns nil when no label has a privacy action.
+func newPrivacyFilter(logger *slog.Logger) *privacyFilter {
+	cfg := config.Privacy()
+	if len(cfg.Labels) == 0 {
+		return nil
+	}
+	return &privacyFilter{salt: string(cfg.Salt), actions: cfg.Labels, logger: logger}
+}
+
+// summableMetrics are the gauges whose values count something, like
+// sessions or bits per second, and can be added up when their series are
+// merged. Counters are always summable. _info gauges are not, they stay at 1
+// so that joins on them keep working.
+var summableMetrics = map[string]bool{
+	"jellyfin_activity_count":                    true,
+	"jellyfin_device_app_count":                  true,
+	"jellyfin_device_user_count":                 true,
+	"jellyfin_now_playing_bitrate_bps":           true,
+	"jellyfin_now_playing_state":                 true,
+	"jellyfin_now_playing_transcode_bitrate_bps": true,
+	"jellyfin_now_playing_transcode_reason":      true,
+	"jellyfin_user_active":                       true,
+}
+
+// forward sends the metrics from in to out with the privacy actions applied.
+// Rewritten metrics that end up with the same labels are merged into one once
+// in is closed. Summable metrics add up their values, others keep the value
+// of the first series, as adding up positions or ratios makes no sense.
+func (f *privacyFilter) forward(in <-chan prometheus.Metric, out chan<- prometheus.Metric) {
+	merged := make(map[string]*privateMetric)
+	order := []string{}
+	for m := range in {
+		pm, changed, err := f.rewrite(m)
+		if err != nil {
+			f.logger.Error("Couldn't apply privacy settings to metric", "desc", m.Desc(), "err", err)
+			out <- prometheus.NewInvalidMetric(m.Desc(), err)
+			continue
+		}
+		if !changed {
+			out <- m
+			continue
+		}
+		key := pm.key()
+		if existing, ok := merged[key]; ok {
+			if !existing.add(pm.metric) {
+				f.logger.Debug("Keeping first value of merged series", "desc", m.Desc())
+			}
+			continue
+		}
+		merged[key] = pm
+		order = append(order, key)
+	}
+	for _, key := range order {
+		out <- merged[key]
+	}
+}
+
+func (f *privacyFilter) rewrite(m prometheus.Metric) (*privateMetric, bool, error) {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return nil, false, err
+	}
+	mediaType := ""
+	for _, lp := range pb.Label {
+		if lp.GetName() == "type" {
+			mediaType = lp.GetValue()
+		}
+	}
+
+	changed := false
+	labels := make([]*dto.LabelPair, 0, len(pb.Label))
+	for _, lp := range pb.Label {
+		action, ok := f.actions[lp.GetName()]
+		if !ok {
+			labels = append(labels, lp)
+			continue
+		}
+		changed = true
+		var value string
+		switch action {
+		case config.PrivacyDrop:
+			continue
+		case config.PrivacyHash:
+			value = f.hash(lp.GetValue())
+		case config.PrivacyTruncate:
+			value = truncateLabelValue(lp.GetValue(), mediaType)
+		}
+		labels = append(labels, &dto.LabelPair{Name: lp.Name, Value: &value})
+	}
+	pb.Label = labels
+	return &privateMetric{desc: m.Desc(), metric: pb}, changed, nil
+}
+
+// hash replaces value with a stable, salted hash. Empty values stay empty.
+func (f *privacyFilter) hash(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(f.salt + "\x00" + value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// truncateLabelValue reduces an IP address to its /24 (IPv4) or /48 (IPv6)
+// network. Any other value, like a title, is replaced by the media type of
+// the metric.
+func truncateLabelValue(value, mediaType string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		addrPort, err := netip.ParseAddrPort(value)
+		if err != nil {
+			return mediaType
+		}
+		addr = addrPort.Addr()
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return mediaType
+	}
+	return prefix.String()
+}
+
+// privateMetric is a metric with rewritten labels.
+type privateMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+func (m *privateMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m *privateMetric) Write(out *dto.Metric) error {
+	out.Label = m.metric.Label
+	out.Gauge = m.metric.Gauge
+	out.Counter = m.metric.Counter
+	out.Untyped = m.metric.Untyped
+	out.Summary = m.metric.Summary
+	out.Histogram = m.metric.Histogram
+	out.TimestampMs = m.metric.TimestampMs
+	return nil
+}
+
+func (m *privateMetric) key() string {
+	var b strings.Builder
+	b.WriteString(m.desc.String())
+	for _, lp := range m.metric.Label {
+		b.WriteString("\xff" + lp.GetName() + "=" + lp.GetValue())
+	}
+	return b.String()
+}
+
+// fqName returns the name of the metric.
+func (m *privateMetric) fqName() string {
+	// Desc doesn't expose its name, but its String method starts with it.
+	_, name, _ := strings.Cut(m.desc.String(), `fqName: "`)
+	name, _, _ = strings.Cut(name, `"`)
+	return name
+}
+
+// summable reports whether the values of series of m can be added up.
+func (m *privateMetric) summable() bool {
+	if m.metric.Counter != nil {
+		return true
+	}
+	name := m.fqName()
+	return m.metric.Gauge != nil && summableMetrics[name]
+}
+
+// add merges the value of other into m if m is summable, and reports whether
+// it did.
+func (m *privateMetric) add(other *dto.Metric) bool {
+	if !m.summable() {
+		return false
+	}
+	switch {
+	case m.metric.Counter != nil && other.Counter != nil:
+		v := m.metric.Counter.GetValue() + other.Counter.GetValue()
+		m.metric.Counter.Value = &v
+	case m.metric.Gauge != nil && other.Gauge != nil:
+		v := m.metric.Gauge.GetValue() + other.Gauge.GetValue()
+		m.metric.Gauge.Value = &v
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// filterMetrics runs metrics through f and returns the values it forwards by
+// metric name and label values.
+func filterMetrics(t *testing.T, f *privacyFilter, metrics ...prometheus.Metric) map[string]float64 {
+	t.Helper()
+	in := make(chan prometheus.Metric, len(metrics))
+	out := make(chan prometheus.Metric, len(metrics))
+	for _, m := range metrics {
+		in <- m
+	}
+	close(in)
+	f.forward(in, out)
+	close(out)
+
+	values := make(map[string]float64)
+	for m := range out {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		key := (&privateMetric{desc: m.Desc(), metric: pb}).fqName()
+		for _, lp := range pb.Label {
+			key += "," + lp.GetName() + "=" + lp.GetValue()
+		}
+		switch {
+		case pb.Counter != nil:
+			values[key] = pb.Counter.GetValue()
+		case pb.Gauge != nil:
+			values[key] = pb.Gauge.GetValue()
+		}
+	}
+	return values
+}
+
+func TestPrivacyFilterMerge(t *testing.T) {
+	f := &privacyFilter{
+		actions: map[string]string{"username": config.PrivacyDrop},
+		logger:  slog.New(slog.DiscardHandler),
+	}
+	state := prometheus.NewDesc("jellyfin_now_playing_state", "", []string{"username", "title"}, nil)
+	progress := prometheus.NewDesc("jellyfin_now_playing_progress_ratio", "", []string{"username", "title"}, nil)
+	info := prometheus.NewDesc("jellyfin_now_playing_media_info", "", []string{"username", "title"}, nil)
+	events := prometheus.NewDesc("jellyfin_test_events_total", "", []string{"username"}, nil)
+	sessions := prometheus.NewDesc("jellyfin_now_playing_sessions", "", []string{"state"}, nil)
+
+	got := filterMetrics(t, f,
+		prometheus.MustNewConstMetric(state, prometheus.GaugeValue, 1, "alice", "Heat"),
+		prometheus.MustNewConstMetric(state, prometheus.GaugeValue, 1, "bob", "Heat"),
+		prometheus.MustNewConstMetric(state, prometheus.GaugeValue, 1, "carol", "Ronin"),
+		prometheus.MustNewConstMetric(progress, prometheus.GaugeValue, 0.25, "alice", "Heat"),
+		prometheus.MustNewConstMetric(progress, prometheus.GaugeValue, 0.5, "bob", "Heat"),
+		prometheus.MustNewConstMetric(info, prometheus.GaugeValue, 1, "alice", "Heat"),
+		prometheus.MustNewConstMetric(info, prometheus.GaugeValue, 1, "bob", "Heat"),
+		prometheus.MustNewConstMetric(events, prometheus.CounterValue, 3, "alice"),
+		prometheus.MustNewConstMetric(events, prometheus.CounterValue, 4, "bob"),
+		prometheus.MustNewConstMetric(sessions, prometheus.GaugeValue, 2, "playing"),
+	)
+	want := map[string]float64{
+		"jellyfin_now_playing_state,title=Heat":          2,
+		"jellyfin_now_playing_state,title=Ronin":         1,
+		"jellyfin_now_playing_progress_ratio,title=Heat": 0.25,
+		"jellyfin_now_playing_media_info,title=Heat":     1,
+		"jellyfin_test_events_total":                     7,
+		"jellyfin_now_playing_sessions,state=playing":    2,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d series, want %d: %v", len(got), len(want), got)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s: got %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestPrivacyFilterRewrite(t *testing.T) {
+	f := &privacyFilter{
+		salt: "salt",
+		actions: map[string]string{
+			"username":   config.PrivacyHash,
+			"ip_address": config.PrivacyTruncate,
+			"title":      config.PrivacyTruncate,
+		},
+		logger: slog.New(slog.DiscardHandler),
+	}
+	desc := prometheus.NewDesc("jellyfin_user_active", "", []string{"username", "ip_address", "title", "type"}, nil)
+	got := filterMetrics(t, f,
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, "alice", "192.0.2.7", "Heat", "Movie"),
+	)
+	key := "jellyfin_user_active,ip_address=192.0.2.0/24,title=Movie,type=Movie,username=" + f.hash("alice")
+	if _, ok := got[key]; !ok || len(got) != 1 {
+		t.Errorf("got %v, want %s", got, key)
+	}
+}
+
+func TestPrivacyHash(t *testing.T) {
+	f := &privacyFilter{salt: "salt"}
+	if f.hash("alice") != f.hash("alice") {
+		t.Error("hash is not stable")
+	}
+	if f.hash("alice") == f.hash("bob") {
+		t.Error("different values have the same hash")
+	}
+	if other := (&privacyFilter{salt: "pepper"}); other.hash("alice") == f.hash("alice") {
+		t.Error("hash doesn't depend on the salt")
+	}
+	if f.hash("") != "" {
+		t.Error("empty value was hashed")
+	}
+}
+
+func TestTruncateLabelValue(t *testing.T) {
+	for _, tc := range []struct {
+		value, mediaType, want string
+	}{
+		{"192.0.2.7", "Movie", "192.0.2.0/24"},
+		{"192.0.2.7:8096", "Movie", "192.0.2.0/24"},
+		{"::ffff:192.0.2.7", "Movie", "192.0.2.0/24"},
+		{"2001:db8:1:2::7", "Movie", "2001:db8:1::/48"},
+		{"Heat", "Movie", "Movie"},
+		{"", "Episode", "Episode"},
+	} {
+		if got := truncateLabelValue(tc.value, tc.mediaType); got != tc.want {
+			t.Errorf("truncateLabelValue(%q, %q) = %q, want %q", tc.value, tc.mediaType, got, tc.want)
+		}
+	}
+}
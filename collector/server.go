@@ -0,0 +1,135 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noserver
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+type JellyfinInstallation struct {
+	Guid    string `json:"Guid"`
+	Name    string `json:"Name"`
+	Version string `json:"Version"`
+}
+
+type JellyfinSystemInfo struct {
+	ServerName                 string                 `json:"ServerName"`
+	Version                    string                 `json:"Version"`
+	Id                         string                 `json:"Id"`
+	OperatingSystem            string                 `json:"OperatingSystem"`
+	OperatingSystemDisplayName string                 `json:"OperatingSystemDisplayName"`
+	SystemArchitecture         string                 `json:"SystemArchitecture"`
+	HasPendingRestart          bool                   `json:"HasPendingRestart"`
+	HasUpdateAvailable         bool                   `json:"HasUpdateAvailable"`
+	IsShuttingDown             bool                   `json:"IsShuttingDown"`
+	CompletedInstallations     []JellyfinInstallation `json:"CompletedInstallations"`
+}
+
+type serverCollector struct {
+	serverInfo             *prometheus.Desc
+	pendingRestart         *prometheus.Desc
+	updateAvailable        *prometheus.Desc
+	shuttingDown           *prometheus.Desc
+	completedInstallations *prometheus.Desc
+	client                 *utils.Client
+	logger                 *slog.Logger
+}
+
+func init() {
+	registerCollector("server", defaultEnabled, NewServerCollector)
+}
+
+func NewServerCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "server"
+	serverInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "info"),
+		"Jellyfin server information.",
+		[]string{"version", "server_name", "id", "os", "architecture"}, nil,
+	)
+	pendingRestart := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "has_pending_restart"),
+		"Whether the Jellyfin server needs a restart to apply changes.",
+		nil, nil,
+	)
+	updateAvailable := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "has_update_available"),
+		"Whether a Jellyfin server update is available.",
+		nil, nil,
+	)
+	shuttingDown := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "is_shutting_down"),
+		"Whether the Jellyfin server is shutting down.",
+		nil, nil,
+	)
+	// Jellyfin's API doesn't list installations in progress, only those
+	// completed since the server started, so that count is exposed instead.
+	completedInstallations := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "completed_installations"),
+		"Package installations completed since the Jellyfin server started, applied on the next restart. Installations in progress are not exposed by the Jellyfin API.",
+		nil, nil,
+	)
+	return &serverCollector{
+		serverInfo:             serverInfo,
+		pendingRestart:         pendingRestart,
+		updateAvailable:        updateAvailable,
+		shuttingDown:           shuttingDown,
+		completedInstallations: completedInstallations,
+		client:                 utils.NewClient(target),
+		logger:                 logger,
+	}, nil
+}
+
+func getSystemInfo(ctx context.Context, client *utils.Client) (JellyfinSystemInfo, error) {
+	var info JellyfinSystemInfo
+	if err := client.Get(ctx, "/System/Info", &info); err != nil {
+		return JellyfinSystemInfo{}, err
+	}
+	return info, nil
+}
+
+func (c *serverCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	info, err := getSystemInfo(ctx, c.client)
+	if err != nil {
+		c.logger.Error("Failed to get system info", "error", err)
+		return err
+	}
+	operatingSystem := info.OperatingSystemDisplayName
+	if operatingSystem == "" {
+		operatingSystem = info.OperatingSystem
+	}
+	c.logger.Debug("Jellyfin server info", "Version", info.Version, "Name", info.ServerName)
+	ch <- prometheus.MustNewConstMetric(
+		c.serverInfo,
+		prometheus.GaugeValue,
+		1,
+		info.Version,
+		info.ServerName,
+		info.Id,
+		operatingSystem,
+		info.SystemArchitecture,
+	)
+	ch <- prometheus.MustNewConstMetric(c.pendingRestart, prometheus.GaugeValue, boolToFloat(info.HasPendingRestart))
+	ch <- prometheus.MustNewConstMetric(c.updateAvailable, prometheus.GaugeValue, boolToFloat(info.HasUpdateAvailable))
+	ch <- prometheus.MustNewConstMetric(c.shuttingDown, prometheus.GaugeValue, boolToFloat(info.IsShuttingDown))
+	ch <- prometheus.MustNewConstMetric(c.completedInstallations, prometheus.GaugeValue, float64(len(info.CompletedInstallations)))
+	return nil
+}
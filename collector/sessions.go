@@ -0,0 +1,54 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// sessionFilter drops the sessions excluded in the config file, as well as
+// the sessions of the exporter itself.
+type sessionFilter struct {
+	clients       map[string]bool
+	deviceIDs     map[string]bool
+	withoutUserID bool
+}
+
+func newSessionFilter() sessionFilter {
+	cfg := config.Sessions()
+	f := sessionFilter{
+		clients:       make(map[string]bool),
+		deviceIDs:     map[string]bool{utils.DeviceID(): true},
+		withoutUserID: cfg.ExcludeWithoutUser,
+	}
+	for _, client := range cfg.ExcludeClients {
+		f.clients[strings.ToLower(client)] = true
+	}
+	for _, id := range cfg.ExcludeDeviceIDs {
+		f.deviceIDs[id] = true
+	}
+	return f
+}
+
+// keep reports whether a session of client on device deviceID, logged in as
+// userID, should be reported.
+func (f sessionFilter) keep(client, deviceID, userID string) bool {
+	if f.withoutUserID && userID == "" {
+		return false
+	}
+	return !f.clients[strings.ToLower(client)] && !f.deviceIDs[deviceID]
+}
@@ -16,7 +16,7 @@
 package collector
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,6 +27,7 @@ import (
 
 type systemCollector struct {
 	systemUp *prometheus.Desc
+	client   *utils.Client
 	logger   *slog.Logger
 }
 
@@ -34,7 +35,7 @@ func init() {
 	registerCollector("system", defaultEnabled, NewSystemCollector)
 }
 
-func NewSystemCollector(logger *slog.Logger) (Collector, error) {
+func NewSystemCollector(logger *slog.Logger, target config.Target) (Collector, error) {
 
 	const subsystem = "system"
 	systemUp := prometheus.NewDesc(
@@ -44,17 +45,17 @@ func NewSystemCollector(logger *slog.Logger) (Collector, error) {
 	)
 	return &systemCollector{
 		systemUp: systemUp,
+		client:   utils.NewClient(target),
 		logger:   logger,
 	}, nil
 }
 
-func (c *systemCollector) Update(ch chan<- prometheus.Metric) error {
-	jellyfinURL, jellyfinToken, nil := config.JellyfinInfo(c.logger)
-
-	jellyfinAPIURL := fmt.Sprintf("%s/System/Ping", jellyfinURL)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
+func (c *systemCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var ping string
 	systemUpValue := 0
-	if rawData == "Jellyfin Server" {
+	if err := c.client.Get(ctx, "/System/Ping", &ping); err != nil {
+		c.logger.Debug("Jellyfin Media System ping failed", "error", err)
+	} else if ping == "Jellyfin Server" {
 		systemUpValue = 1
 	}
 	c.logger.Debug("Jellyfin Media System state", "Up", systemUpValue)
@@ -0,0 +1,158 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !notasks
+
+package collector
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	taskStates         = []string{"Idle", "Running", "Cancelling"}
+	taskResultStatuses = []string{"Completed", "Failed", "Cancelled", "Aborted"}
+)
+
+type TaskResult struct {
+	StartTimeUtc string `json:"StartTimeUtc"`
+	EndTimeUtc   string `json:"EndTimeUtc"`
+	Status       string `json:"Status"`
+	ErrorMessage string `json:"ErrorMessage"`
+}
+
+type JellyfinTask struct {
+	Name                      string      `json:"Name"`
+	State                     string      `json:"State"`
+	CurrentProgressPercentage *float64    `json:"CurrentProgressPercentage"`
+	Id                        string      `json:"Id"`
+	LastExecutionResult       *TaskResult `json:"LastExecutionResult"`
+	Category                  string      `json:"Category"`
+	IsHidden                  bool        `json:"IsHidden"`
+	Key                       string      `json:"Key"`
+}
+
+type tasksCollector struct {
+	taskState           *prometheus.Desc
+	taskProgress        *prometheus.Desc
+	lastExecutionStatus *prometheus.Desc
+	lastExecutionStart  *prometheus.Desc
+	lastExecutionEnd    *prometheus.Desc
+	lastExecutionTime   *prometheus.Desc
+	client              *utils.Client
+	logger              *slog.Logger
+}
+
+func init() {
+	registerCollector("tasks", defaultEnabled, NewTasksCollector)
+}
+
+func NewTasksCollector(logger *slog.Logger, target config.Target) (Collector, error) {
+	const subsystem = "scheduled_task"
+	taskLabels := []string{"name", "category"}
+	taskState := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "state"),
+		"Jellyfin scheduled task state.",
+		append(taskLabels, "state"), nil,
+	)
+	taskProgress := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "progress_percent"),
+		"Jellyfin scheduled task progress of the current run.",
+		taskLabels, nil,
+	)
+	lastExecutionStatus := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "last_execution_status"),
+		"Jellyfin scheduled task status of the last run.",
+		append(taskLabels, "status"), nil,
+	)
+	lastExecutionStart := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "last_execution_start_timestamp_seconds"),
+		"Jellyfin scheduled task start time of the last run.",
+		taskLabels, nil,
+	)
+	lastExecutionEnd := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "last_execution_end_timestamp_seconds"),
+		"Jellyfin scheduled task end time of the last run.",
+		taskLabels, nil,
+	)
+	lastExecutionTime := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "last_execution_duration_seconds"),
+		"Jellyfin scheduled task duration of the last run.",
+		taskLabels, nil,
+	)
+	return &tasksCollector{
+		taskState:           taskState,
+		taskProgress:        taskProgress,
+		lastExecutionStatus: lastExecutionStatus,
+		lastExecutionStart:  lastExecutionStart,
+		lastExecutionEnd:    lastExecutionEnd,
+		lastExecutionTime:   lastExecutionTime,
+		client:              utils.NewClient(target),
+		logger:              logger,
+	}, nil
+}
+
+func getScheduledTasks(ctx context.Context, client *utils.Client) ([]JellyfinTask, error) {
+	var tasks []JellyfinTask
+	if err := client.Get(ctx, "/ScheduledTasks", &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (c *tasksCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	tasks, err := getScheduledTasks(ctx, c.client)
+	if err != nil {
+		c.logger.Error("Failed to get scheduled tasks", "error", err)
+		return err
+	}
+	for _, task := range tasks {
+		c.logger.Debug("Jellyfin scheduled task", "Name", task.Name, "State", task.State)
+		for _, state := range taskStates {
+			ch <- prometheus.MustNewConstMetric(c.taskState, prometheus.GaugeValue,
+				boolToFloat(task.State == state), task.Name, task.Category, state)
+		}
+		progress := 0.0
+		if task.CurrentProgressPercentage != nil {
+			progress = *task.CurrentProgressPercentage
+		}
+		ch <- prometheus.MustNewConstMetric(c.taskProgress, prometheus.GaugeValue, progress, task.Name, task.Category)
+
+		result := task.LastExecutionResult
+		if result == nil {
+			continue
+		}
+		for _, status := range taskResultStatuses {
+			ch <- prometheus.MustNewConstMetric(c.lastExecutionStatus, prometheus.GaugeValue,
+				boolToFloat(result.Status == status), task.Name, task.Category, status)
+		}
+		start, startErr := parseJellyfinTime(result.StartTimeUtc)
+		if startErr == nil {
+			ch <- prometheus.MustNewConstMetric(c.lastExecutionStart, prometheus.GaugeValue, float64(start.Unix()), task.Name, task.Category)
+		}
+		end, endErr := parseJellyfinTime(result.EndTimeUtc)
+		if endErr == nil {
+			ch <- prometheus.MustNewConstMetric(c.lastExecutionEnd, prometheus.GaugeValue, float64(end.Unix()), task.Name, task.Category)
+		}
+		if startErr == nil && endErr == nil {
+			ch <- prometheus.MustNewConstMetric(c.lastExecutionTime, prometheus.GaugeValue, end.Sub(start).Seconds(), task.Name, task.Category)
+		}
+	}
+	return nil
+}
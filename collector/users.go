@@ -16,8 +16,8 @@
 package collector
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"errors"
 	"log/slog"
 	"strconv"
 	"time"
@@ -47,6 +47,7 @@ type JellyfinSessionUser struct {
 	Client             string `json:"Client"`
 	ApplicationVersion string `json:"ApplicationVersion"`
 	DeviceName         string `json:"DeviceName"`
+	DeviceId           string `json:"DeviceId"`
 	RemoteEndPoint     string `json:"RemoteEndPoint"`
 }
 
@@ -62,6 +63,7 @@ type Account struct {
 type userCollector struct {
 	userAccount *prometheus.Desc
 	userActive  *prometheus.Desc
+	client      *utils.Client
 	logger      *slog.Logger
 }
 
@@ -69,7 +71,7 @@ func init() {
 	registerCollector("users", defaultEnabled, NewUsersCollector)
 }
 
-func NewUsersCollector(logger *slog.Logger) (Collector, error) {
+func NewUsersCollector(logger *slog.Logger, target config.Target) (Collector, error) {
 	const subsystem = "user"
 	userAccount := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "account"),
@@ -79,27 +81,20 @@ func NewUsersCollector(logger *slog.Logger) (Collector, error) {
 	userActive := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, subsystem, "active"),
 		"Jellyfin current active users.",
-		[]string{"user_id", "username", "client", "client_version", "device", "ip_address"}, nil,
+		append([]string{"user_id", "username", "client", "client_version", "device", "ip_address"}, locationLabels()...), nil,
 	)
 	return &userCollector{
 		userAccount: userAccount,
 		userActive:  userActive,
+		client:      utils.NewClient(target),
 		logger:      logger,
 	}, nil
 }
 
-func getUserAccount(jellyfinURL, jellyfinToken string) ([]Account, error) {
-	jellyfinAPIURL := fmt.Sprintf("%s/Users", jellyfinURL)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
-
-	rawBody, err := utils.CoerceToJSONBytes(rawData)
-	if err != nil {
-		return nil, err
-	}
-
+func getUserAccount(ctx context.Context, client *utils.Client) ([]Account, error) {
 	var users []JellyfinUser
-	if err := json.Unmarshal(rawBody, &users); err != nil {
-		return nil, fmt.Errorf("unexpected response from Jellyfin API: %w", err)
+	if err := client.Get(ctx, "/Users", &users); err != nil {
+		return nil, err
 	}
 
 	accounts := make([]Account, 0, len(users))
@@ -132,37 +127,23 @@ func getUserAccount(jellyfinURL, jellyfinToken string) ([]Account, error) {
 	return accounts, nil
 }
 
-func getUserActive(jellyfinURL, jellyfinToken string) ([]JellyfinSessionUser, error) {
-	jellyfinAPIURL := fmt.Sprintf("%s/Sessions", jellyfinURL)
-	rawData := utils.GetHTTP(jellyfinAPIURL, jellyfinToken)
-
-	rawBody, err := utils.CoerceToJSONBytes(rawData)
-	if err != nil {
-		return nil, err
-	}
-
+func getUserActive(ctx context.Context, client *utils.Client) ([]JellyfinSessionUser, error) {
 	var sessions []JellyfinSessionUser
-	if err := json.Unmarshal(rawBody, &sessions); err != nil {
-		return nil, fmt.Errorf("unexpected response from Jellyfin API: %w", err)
+	if err := client.Get(ctx, "/Sessions", &sessions); err != nil {
+		return nil, err
 	}
 	return sessions, nil
 }
 
-func (c *userCollector) Update(ch chan<- prometheus.Metric) error {
-	jellyfinURL, jellyfinToken, err := config.JellyfinInfo(c.logger)
-	if err != nil {
-		c.logger.Error("Failed to get Jellyfin config", "error", err)
-		return err
-	}
-
-	userAccounts, err := getUserAccount(jellyfinURL, jellyfinToken)
-	if err != nil {
-		c.logger.Error("Failed to get user accounts", "error", err)
+func (c *userCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	userAccounts, accountErr := getUserAccount(ctx, c.client)
+	if accountErr != nil {
+		c.logger.Error("Failed to get user accounts", "error", accountErr)
 	}
 
-	userActive, err := getUserActive(jellyfinURL, jellyfinToken)
-	if err != nil {
-		c.logger.Error("Failed to get user sessions", "error", err)
+	userActive, sessionErr := getUserActive(ctx, c.client)
+	if sessionErr != nil {
+		c.logger.Error("Failed to get user sessions", "error", sessionErr)
 	}
 
 	for _, userMap := range userAccounts {
@@ -177,21 +158,27 @@ func (c *userCollector) Update(ch chan<- prometheus.Metric) error {
 		)
 	}
 
+	filter := newSessionFilter()
+	locator := newSessionLocator(c.logger)
 	for _, session := range userActive {
+		if !filter.keep(session.Client, session.DeviceId, session.UserId) {
+			c.logger.Debug("Skipping filtered session", "Client", session.Client, "DeviceId", session.DeviceId)
+			continue
+		}
 		c.logger.Debug("Jellyfin user account active", "Value", session.UserName)
 		remoteEndPoint := session.RemoteEndPoint
 
-		ch <- prometheus.MustNewConstMetric(c.userActive,
-			prometheus.GaugeValue,
-			1,
+		labelValues := []string{
 			session.UserId,
 			session.UserName,
 			session.Client,
 			session.ApplicationVersion,
 			session.DeviceName,
 			remoteEndPoint,
-		)
+		}
+		labelValues = append(labelValues, locator.locate(remoteEndPoint)...)
+		ch <- prometheus.MustNewConstMetric(c.userActive, prometheus.GaugeValue, 1, labelValues...)
 	}
 
-	return nil
+	return errors.Join(accountErr, sessionErr)
 }
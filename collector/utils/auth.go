@@ -0,0 +1,210 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+const authenticatePath = "/Users/AuthenticateByName"
+
+type sessionKey struct {
+	url      string
+	username string
+}
+
+const (
+	// loginBackoff is the delay before logging in again after Jellyfin
+	// rejected the credentials. It doubles with every rejected login up to
+	// maxLoginBackoff, so that a wrong password doesn't lock the account.
+	loginBackoff    = 30 * time.Second
+	maxLoginBackoff = 15 * time.Minute
+)
+
+// session is the login state of a user on a Jellyfin server.
+type session struct {
+	token string
+	// pending is closed once the running login finishes.
+	pending chan struct{}
+	// err is the error of the last rejected login, returned until retryAt
+	// unless the password changes.
+	err      error
+	password string
+	retryAt  time.Time
+	failures int
+}
+
+var (
+	sessionsMtx = sync.Mutex{}
+	sessions    = make(map[sessionKey]*session)
+)
+
+// authorization returns the MediaBrowser authorization header identifying
+// the exporter as a Jellyfin client. token is left out when empty.
+func authorization(token string) string {
+	auth := fmt.Sprintf(`MediaBrowser Client="jellyfin_exporter", Device=%q, DeviceId=%q, Version=%q`,
+		deviceName(), DeviceID(), exporterVersion())
+	if token != "" {
+		auth += fmt.Sprintf(", Token=%q", token)
+	}
+	return auth
+}
+
+// accessToken returns the token to authenticate requests to target with,
+// logging in with the username and password of target if needed. Session
+// tokens are cached until forgetSession is called. Concurrent requests share
+// a single login, and a rejected login is not tried again before its backoff
+// has passed or the password has changed.
+func accessToken(ctx context.Context, target config.Target) (string, error) {
+	if target.Username() == "" {
+		return target.Token()
+	}
+	key := sessionKey{url: target.URL, username: target.Username()}
+	for {
+		sessionsMtx.Lock()
+		s, ok := sessions[key]
+		if !ok {
+			s = &session{}
+			sessions[key] = s
+		}
+		if s.token != "" {
+			token := s.token
+			sessionsMtx.Unlock()
+			return token, nil
+		}
+		if pending := s.pending; pending != nil {
+			sessionsMtx.Unlock()
+			select {
+			case <-pending:
+				continue
+			case <-ctx.Done():
+				return "", &APIError{Endpoint: authenticatePath, Err: ctx.Err()}
+			}
+		}
+		if s.err != nil && time.Now().Before(s.retryAt) {
+			if password, err := target.Password(); err != nil || password == s.password {
+				err := s.err
+				sessionsMtx.Unlock()
+				return "", err
+			}
+		}
+		pending := make(chan struct{})
+		s.pending = pending
+		sessionsMtx.Unlock()
+
+		token, password, err := authenticate(ctx, target)
+
+		sessionsMtx.Lock()
+		s.pending = nil
+		close(pending)
+		switch {
+		case err == nil:
+			s.token, s.err, s.failures = token, nil, 0
+		case loginRejected(err) && ctx.Err() == nil:
+			backoff := loginBackoff << s.failures
+			if backoff <= 0 || backoff > maxLoginBackoff {
+				backoff = maxLoginBackoff
+			}
+			s.err, s.password, s.retryAt = err, password, time.Now().Add(backoff)
+			s.failures++
+		}
+		sessionsMtx.Unlock()
+		return token, err
+	}
+}
+
+// loginRejected reports whether Jellyfin answered a login with an error
+// other than being temporarily unavailable, usually wrong credentials.
+func loginRejected(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode != 0 && !retryableStatus(apiErr.StatusCode)
+}
+
+// forgetSession drops the cached session token of target, unless another
+// request already replaced it.
+func forgetSession(target config.Target, token string) {
+	key := sessionKey{url: target.URL, username: target.Username()}
+	sessionsMtx.Lock()
+	defer sessionsMtx.Unlock()
+	if s, ok := sessions[key]; ok && s.token == token {
+		s.token = ""
+	}
+}
+
+type authenticateRequest struct {
+	Username string `json:"Username"`
+	Pw       string `json:"Pw"`
+}
+
+type authenticateResponse struct {
+	AccessToken string `json:"AccessToken"`
+}
+
+// authenticate logs in to target and returns the session token and the
+// password it used.
+func authenticate(ctx context.Context, target config.Target) (token, password string, err error) {
+	password, err = target.Password()
+	if err != nil {
+		return "", "", err
+	}
+	body, err := json.Marshal(authenticateRequest{Username: target.Username(), Pw: password})
+	if err != nil {
+		return "", password, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL+authenticatePath, bytes.NewReader(body))
+	if err != nil {
+		return "", password, &APIError{Endpoint: authenticatePath, Err: err}
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("X-Emby-Authorization", authorization(""))
+
+	begin := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		observeRequest(authenticatePath, "error", time.Since(begin), 0)
+		return "", password, &APIError{Endpoint: authenticatePath, Err: err}
+	}
+	respBody := &countingReader{r: resp.Body}
+	defer func() {
+		_, _ = io.Copy(io.Discard, respBody)
+		_ = resp.Body.Close()
+		observeRequest(authenticatePath, strconv.Itoa(resp.StatusCode), time.Since(begin), respBody.n)
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", password, &APIError{Endpoint: authenticatePath, StatusCode: resp.StatusCode}
+	}
+	var result authenticateResponse
+	if err := json.NewDecoder(respBody).Decode(&result); err != nil {
+		return "", password, &APIError{Endpoint: authenticatePath, Err: fmt.Errorf("unexpected response: %w", err)}
+	}
+	if result.AccessToken == "" {
+		return "", password, &APIError{Endpoint: authenticatePath, Err: fmt.Errorf("no access token in response")}
+	}
+	return result.AccessToken, password, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// loginServer accepts logins with password and hands out a new token for
+// every login. API requests succeed with the latest token, unless
+// rejectTokens is set.
+type loginServer struct {
+	*httptest.Server
+	password     string
+	attempts     atomic.Int32
+	logins       atomic.Int32
+	generation   atomic.Int32
+	requests     atomic.Int32
+	rejectTokens atomic.Bool
+	// release, when set, holds logins until it is closed.
+	release chan struct{}
+}
+
+func newLoginServer(t *testing.T, password string) *loginServer {
+	t.Helper()
+	s := &loginServer{password: password}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == authenticatePath {
+			s.attempts.Add(1)
+			if s.release != nil {
+				<-s.release
+			}
+			var req authenticateRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Pw != s.password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			s.logins.Add(1)
+			_ = json.NewEncoder(w).Encode(authenticateResponse{AccessToken: s.token(s.generation.Add(1))})
+			return
+		}
+		s.requests.Add(1)
+		if s.rejectTokens.Load() || !strings.Contains(r.Header.Get("Authorization"), `Token="`+s.token(s.generation.Load())+`"`) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *loginServer) token(generation int32) string {
+	return "token" + strconv.Itoa(int(generation))
+}
+
+// expire invalidates the token of the last login.
+func (s *loginServer) expire() {
+	s.generation.Add(1)
+}
+
+func writePasswordFile(t *testing.T, path, password string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(password), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAccessTokenSharedLogin(t *testing.T) {
+	srv := newLoginServer(t, "secret")
+	srv.release = make(chan struct{})
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writePasswordFile(t, passwordFile, "secret")
+	target := config.LoginTarget(srv.URL, "exporter", passwordFile)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 5)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := accessToken(context.Background(), target)
+			if err != nil {
+				t.Error(err)
+			}
+			tokens[i] = token
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(srv.release)
+	wg.Wait()
+
+	if n := srv.attempts.Load(); n != 1 {
+		t.Errorf("got %d logins, want 1", n)
+	}
+	for _, token := range tokens {
+		if token != "token1" {
+			t.Errorf("got token %q, want token1", token)
+		}
+	}
+}
+
+func TestAccessTokenRejectedLogin(t *testing.T) {
+	srv := newLoginServer(t, "secret")
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writePasswordFile(t, passwordFile, "wrong")
+	target := config.LoginTarget(srv.URL, "exporter", passwordFile)
+
+	for i := 0; i < 3; i++ {
+		if _, err := accessToken(context.Background(), target); !IsUnauthorized(err) {
+			t.Fatalf("got error %v, want a rejected login", err)
+		}
+	}
+	if n := srv.attempts.Load(); n != 1 {
+		t.Errorf("got %d logins during the backoff, want 1", n)
+	}
+
+	// A new password is tried right away.
+	writePasswordFile(t, passwordFile, "secret")
+	token, err := accessToken(context.Background(), target)
+	if err != nil || token != "token1" {
+		t.Errorf("got token %q and error %v after changing the password", token, err)
+	}
+	if n := srv.attempts.Load(); n != 2 {
+		t.Errorf("got %d logins, want 2", n)
+	}
+}
+
+func TestGetLogsInAgain(t *testing.T) {
+	setRetryPolicy(t, 2, time.Millisecond)
+	setCircuitPolicy(t, 5, time.Hour)
+	srv := newLoginServer(t, "secret")
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writePasswordFile(t, passwordFile, "secret")
+	client := NewClient(config.LoginTarget(srv.URL, "exporter", passwordFile))
+	var v struct{}
+
+	if err := client.Get(context.Background(), "/System/Info", &v); err != nil {
+		t.Fatal(err)
+	}
+	// The session expires, the client logs in again once.
+	srv.expire()
+	if err := client.Get(context.Background(), "/System/Info", &v); err != nil {
+		t.Fatal(err)
+	}
+	if logins, requests := srv.logins.Load(), srv.requests.Load(); logins != 2 || requests != 3 {
+		t.Errorf("got %d logins and %d requests, want 2 and 3", logins, requests)
+	}
+
+	// A token that is rejected right after logging in isn't retried.
+	srv.rejectTokens.Store(true)
+	if err := client.Get(context.Background(), "/System/Info", &v); !IsUnauthorized(err) {
+		t.Errorf("got error %v, want a rejected request", err)
+	}
+	if logins, requests := srv.logins.Load(), srv.requests.Load(); logins != 3 || requests != 5 {
+		t.Errorf("got %d logins and %d requests, want 3 and 5", logins, requests)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	circuitThreshold = kingpin.Flag("jellyfin.circuit-breaker.threshold", "Consecutive failed Jellyfin API requests after which requests are short-circuited. Use 0 to disable the circuit breaker.").Default("5").Int()
+	circuitCooldown  = kingpin.Flag("jellyfin.circuit-breaker.cooldown", "Time the circuit breaker stays open before letting a trial request through.").Default("30s").Duration()
+)
+
+// ErrCircuitOpen is returned instead of sending a request while the circuit
+// breaker of the target is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitResult int
+
+const (
+	// circuitIgnore is a request that says nothing about the server, for
+	// example one cancelled by the scrape.
+	circuitIgnore circuitResult = iota
+	circuitSuccess
+	circuitFailure
+)
+
+// circuitBreaker counts consecutive failed requests to a Jellyfin server.
+// Once threshold is reached it opens and rejects requests for the cooldown,
+// then lets a single trial request through to decide whether to close again.
+type circuitBreaker struct {
+	mtx      sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+
+	// lastUsed is guarded by circuitBreakersMtx.
+	lastUsed time.Time
+}
+
+const (
+	// circuitBreakerTTL is how long the breaker of a server that is no
+	// longer requested is kept. /probe targets are chosen by the caller, so
+	// breakers must not pile up.
+	circuitBreakerTTL = 15 * time.Minute
+	// maxCircuitBreakers caps the number of breakers kept. The least
+	// recently used one is dropped to make room for a new one.
+	maxCircuitBreakers = 1000
+)
+
+var (
+	circuitBreakersMtx = sync.Mutex{}
+	circuitBreakers    = make(map[string]*circuitBreaker)
+)
+
+// circuitBreakerFor returns the circuit breaker shared by all clients of the
+// Jellyfin server at url.
+func circuitBreakerFor(url string) *circuitBreaker {
+	circuitBreakersMtx.Lock()
+	defer circuitBreakersMtx.Unlock()
+	now := time.Now()
+	b, ok := circuitBreakers[url]
+	if !ok {
+		expireCircuitBreakers(now)
+		b = &circuitBreaker{}
+		circuitBreakers[url] = b
+	}
+	b.lastUsed = now
+	return b
+}
+
+// expireCircuitBreakers drops the breakers unused for circuitBreakerTTL and,
+// if there are still too many, the least recently used ones. The caller must
+// hold circuitBreakersMtx.
+func expireCircuitBreakers(now time.Time) {
+	for url, b := range circuitBreakers {
+		if now.Sub(b.lastUsed) > circuitBreakerTTL {
+			delete(circuitBreakers, url)
+		}
+	}
+	for len(circuitBreakers) >= maxCircuitBreakers {
+		var oldest string
+		for url, b := range circuitBreakers {
+			if oldest == "" || b.lastUsed.Before(circuitBreakers[oldest].lastUsed) {
+				oldest = url
+			}
+		}
+		delete(circuitBreakers, oldest)
+	}
+}
+
+func (b *circuitBreaker) allow() bool {
+	if *circuitThreshold <= 0 {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < *circuitCooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.trial = true
+		return true
+	case circuitHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+func (b *circuitBreaker) record(result circuitResult) {
+	if *circuitThreshold <= 0 {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.trial = false
+	switch result {
+	case circuitSuccess:
+		b.state = circuitClosed
+		b.failures = 0
+	case circuitFailure:
+		b.failures++
+		if b.state == circuitHalfOpen || b.failures >= *circuitThreshold {
+			b.state = circuitOpen
+			b.openedAt = time.Now()
+		}
+	}
+}
+
+var circuitStateDesc = prometheus.NewDesc(
+	"jellyfin_exporter_circuit_state",
+	"State of the circuit breaker for a Jellyfin server (0 closed, 1 open, 2 half-open).",
+	[]string{"target"}, nil,
+)
+
+type circuitCollector struct {
+	target string
+}
+
+// NewCircuitCollector returns a collector exposing the state of the circuit
+// breaker of the Jellyfin server at target.
+func NewCircuitCollector(target string) prometheus.Collector {
+	return circuitCollector{target: target}
+}
+
+func (c circuitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- circuitStateDesc
+}
+
+func (c circuitCollector) Collect(ch chan<- prometheus.Metric) {
+	state := circuitClosed
+	circuitBreakersMtx.Lock()
+	b, ok := circuitBreakers[c.target]
+	circuitBreakersMtx.Unlock()
+	if ok {
+		b.mtx.Lock()
+		state = b.state
+		b.mtx.Unlock()
+	}
+	ch <- prometheus.MustNewConstMetric(circuitStateDesc, prometheus.GaugeValue, float64(state), c.target)
+}
@@ -0,0 +1,108 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func setCircuitPolicy(t *testing.T, threshold int, cooldown time.Duration) {
+	t.Helper()
+	oldThreshold, oldCooldown := *circuitThreshold, *circuitCooldown
+	*circuitThreshold, *circuitCooldown = threshold, cooldown
+	t.Cleanup(func() {
+		*circuitThreshold, *circuitCooldown = oldThreshold, oldCooldown
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	setCircuitPolicy(t, 2, 20*time.Millisecond)
+	b := &circuitBreaker{}
+
+	b.record(circuitFailure)
+	if !b.allow() || b.state != circuitClosed {
+		t.Fatalf("breaker opened below threshold, state %d", b.state)
+	}
+	b.record(circuitIgnore)
+	b.record(circuitFailure)
+	if b.allow() || b.state != circuitOpen {
+		t.Fatalf("breaker didn't open at threshold, state %d", b.state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() || b.state != circuitHalfOpen {
+		t.Fatalf("breaker didn't let a trial request through after the cooldown, state %d", b.state)
+	}
+	if b.allow() {
+		t.Fatal("breaker let a second trial request through")
+	}
+	b.record(circuitFailure)
+	if b.allow() || b.state != circuitOpen {
+		t.Fatalf("failed trial request didn't open the breaker again, state %d", b.state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker didn't let a trial request through after the cooldown")
+	}
+	b.record(circuitIgnore)
+	if !b.allow() || b.state != circuitHalfOpen {
+		t.Fatalf("ignored trial request didn't free the trial, state %d", b.state)
+	}
+	b.record(circuitSuccess)
+	if !b.allow() || b.state != circuitClosed || b.failures != 0 {
+		t.Fatalf("successful trial request didn't close the breaker, state %d, failures %d", b.state, b.failures)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	setCircuitPolicy(t, 0, time.Hour)
+	b := &circuitBreaker{}
+	for i := 0; i < 10; i++ {
+		b.record(circuitFailure)
+	}
+	if !b.allow() || b.state != circuitClosed {
+		t.Fatalf("disabled breaker rejected a request, state %d", b.state)
+	}
+}
+
+func TestCircuitBreakerExpiry(t *testing.T) {
+	circuitBreakersMtx.Lock()
+	circuitBreakers = make(map[string]*circuitBreaker)
+	circuitBreakersMtx.Unlock()
+
+	stale := circuitBreakerFor("http://stale")
+	circuitBreakersMtx.Lock()
+	stale.lastUsed = time.Now().Add(-circuitBreakerTTL - time.Minute)
+	circuitBreakersMtx.Unlock()
+	circuitBreakerFor("http://fresh")
+	if _, ok := circuitBreakers["http://stale"]; ok {
+		t.Error("unused breaker was not dropped")
+	}
+
+	for i := 0; i < maxCircuitBreakers+10; i++ {
+		circuitBreakerFor(fmt.Sprintf("http://target-%d", i))
+	}
+	if n := len(circuitBreakers); n > maxCircuitBreakers {
+		t.Errorf("got %d breakers, want at most %d", n, maxCircuitBreakers)
+	}
+	if _, ok := circuitBreakers["http://fresh"]; ok {
+		t.Error("least recently used breaker was not dropped")
+	}
+	if _, ok := circuitBreakers[fmt.Sprintf("http://target-%d", maxCircuitBreakers+9)]; !ok {
+		t.Error("most recently used breaker was dropped")
+	}
+}
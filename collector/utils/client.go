@@ -0,0 +1,186 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+// httpClient is shared by all Clients so that connections to the same
+// Jellyfin server are reused across collectors and scrapes. Requests are
+// bounded by the context of the scrape instead of a client timeout.
+var httpClient = &http.Client{
+	Transport: newTransport(),
+}
+
+func newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 10
+	return transport
+}
+
+// APIError is returned by Client when a request to the Jellyfin API fails.
+// StatusCode is 0 when no HTTP response was received.
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("jellyfin api %s returned %d %s", e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("jellyfin api %s: %s", e.Endpoint, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnauthorized reports whether err was caused by Jellyfin rejecting the
+// credentials of the request.
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// isSessionExpired reports whether Jellyfin rejected the token of a request.
+func isSessionExpired(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Endpoint != authenticatePath && apiErr.StatusCode == http.StatusUnauthorized
+}
+
+// isLoginError reports whether err was caused by logging in, possibly a
+// rejected login returned again without sending a request.
+func isLoginError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Endpoint == authenticatePath
+}
+
+// Client talks to the API of a single Jellyfin server.
+type Client struct {
+	target config.Target
+}
+
+func NewClient(target config.Target) *Client {
+	return &Client{target: target}
+}
+
+// Get requests path, relative to the Jellyfin address, and decodes the JSON
+// response into v. Requests that fail because the server is unavailable are
+// retried with a jittered exponential backoff.
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return &APIError{Endpoint: path, Err: err}
+	}
+	breaker := circuitBreakerFor(c.target.URL)
+	if !breaker.allow() {
+		return &APIError{Endpoint: path, Err: ErrCircuitOpen}
+	}
+
+	retries, backoff := retryPolicy()
+	reauthenticated := false
+	for attempt := 0; ; attempt++ {
+		unavailable, err := c.get(ctx, path, v)
+		if isSessionExpired(err) && c.target.Username() != "" && !reauthenticated {
+			// The session token was revoked or expired, log in again.
+			reauthenticated = true
+			attempt--
+			continue
+		}
+		if err == nil {
+			breaker.record(circuitSuccess)
+			return nil
+		}
+		if !unavailable {
+			switch {
+			case errors.Is(ctx.Err(), context.Canceled) || isLoginError(err):
+				// The scrape was cancelled or the login failed, which
+				// says nothing about the server.
+				breaker.record(circuitIgnore)
+			case ctx.Err() != nil:
+				// The server didn't answer within the collector timeout.
+				breaker.record(circuitFailure)
+			default:
+				breaker.record(circuitSuccess)
+			}
+			return err
+		}
+		if attempt >= retries || ctx.Err() != nil || !sleep(ctx, retryDelay(backoff, attempt)) {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				breaker.record(circuitIgnore)
+			} else {
+				breaker.record(circuitFailure)
+			}
+			return err
+		}
+	}
+}
+
+// get sends a single request. unavailable reports whether the request failed
+// because the server couldn't be reached or is temporarily unable to answer.
+func (c *Client) get(ctx context.Context, path string, v interface{}) (unavailable bool, err error) {
+	token, err := accessToken(ctx, c.target)
+	if err != nil {
+		var apiErr *APIError
+		return errors.As(err, &apiErr) && (apiErr.StatusCode == 0 || retryableStatus(apiErr.StatusCode)), err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.target.URL+path, nil)
+	if err != nil {
+		return false, &APIError{Endpoint: path, Err: err}
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("Authorization", authorization(token))
+
+	endpoint := endpointTemplate(path)
+	begin := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		observeRequest(endpoint, "error", time.Since(begin), 0)
+		return true, &APIError{Endpoint: path, Err: err}
+	}
+	body := &countingReader{r: resp.Body}
+	defer func() {
+		// Drain the body so that the connection can be reused.
+		_, _ = io.Copy(io.Discard, body)
+		_ = resp.Body.Close()
+		observeRequest(endpoint, strconv.Itoa(resp.StatusCode), time.Since(begin), body.n)
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if resp.StatusCode == http.StatusUnauthorized && c.target.Username() != "" {
+			forgetSession(c.target, token)
+		}
+		return retryableStatus(resp.StatusCode), &APIError{Endpoint: path, StatusCode: resp.StatusCode}
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return false, &APIError{Endpoint: path, Err: fmt.Errorf("unexpected response: %w", err)}
+	}
+	return false, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/prometheus/common/version"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	jellyfinDeviceID = kingpin.Flag("jellyfin.device-id", "Device ID the exporter reports to Jellyfin. Defaults to an ID derived from the hostname.").PlaceHolder("ID").String()
+)
+
+func deviceName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "unknown"
+	}
+	return hostname
+}
+
+// DeviceID returns the device ID the exporter reports to Jellyfin, so that
+// its own sessions and devices can be recognized.
+func DeviceID() string {
+	if id, ok := config.DeviceID(); ok {
+		return id
+	}
+	if *jellyfinDeviceID != "" {
+		return *jellyfinDeviceID
+	}
+	sum := sha256.Sum256([]byte("jellyfin_exporter:" + deviceName()))
+	return hex.EncodeToString(sum[:16])
+}
+
+// exporterVersion returns the version the exporter was built with, which is
+// empty for builds without the version flags set by promu.
+func exporterVersion() string {
+	if version.Version == "" {
+		return "unknown"
+	}
+	return version.Version
+}
+
+func userAgent() string {
+	return "jellyfin_exporter/" + exporterVersion()
+}
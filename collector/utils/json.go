@@ -1,32 +0,0 @@
-// Copyright 2010 Rebel Media
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-// http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package utils
-
-import (
-	"encoding/json"
-	"fmt"
-)
-
-func CoerceToJSONBytes(rawData interface{}) ([]byte, error) {
-	switch v := rawData.(type) {
-	case []byte:
-		return v, nil
-	case string:
-		return []byte(v), nil
-	case []interface{}, map[string]interface{}:
-		return json.Marshal(v)
-	default:
-		return nil, fmt.Errorf("unexpected data for api: %T", v)
-	}
-}
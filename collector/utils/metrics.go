@@ -0,0 +1,88 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "jellyfin_exporter",
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of Jellyfin API requests by endpoint and status code.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"endpoint", "code"},
+	)
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "jellyfin_exporter",
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Total number of Jellyfin API requests by endpoint and status code.",
+		},
+		[]string{"endpoint", "code"},
+	)
+	apiResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "jellyfin_exporter",
+			Subsystem: "api",
+			Name:      "response_size_bytes",
+			Help:      "Size of Jellyfin API responses by endpoint.",
+			Buckets:   prometheus.ExponentialBuckets(256, 4, 8),
+		},
+		[]string{"endpoint"},
+	)
+)
+
+// RegisterMetrics registers the metrics of the Jellyfin API client with reg.
+func RegisterMetrics(reg prometheus.Registerer) {
+	reg.MustRegister(apiRequestDuration, apiRequests, apiResponseSize)
+}
+
+// endpointTemplate strips the query string from path so that the endpoint
+// label doesn't grow with every parameter value.
+func endpointTemplate(path string) string {
+	endpoint, _, _ := strings.Cut(path, "?")
+	return endpoint
+}
+
+// observeRequest records a finished request. code is "error" when no HTTP
+// response was received.
+func observeRequest(endpoint, code string, duration time.Duration, size int64) {
+	apiRequestDuration.WithLabelValues(endpoint, code).Observe(duration.Seconds())
+	apiRequests.WithLabelValues(endpoint, code).Inc()
+	if code != "error" {
+		apiResponseSize.WithLabelValues(endpoint).Observe(float64(size))
+	}
+}
+
+// countingReader counts the bytes read from the response body.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
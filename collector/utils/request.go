@@ -1,52 +0,0 @@
-// Copyright 2010 Rebel Media
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-// http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package utils
-
-import (
-	"encoding/json"
-	"io"
-	"net/http"
-	"time"
-)
-
-func GetHTTP(url, token string) interface{} {
-	client := http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil
-	}
-
-	req.Header.Set("Authorization", "MediaBrowser Token="+token)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil
-	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			return
-		}
-	}(resp.Body)
-	var result interface{}
-
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&result)
-	if err != nil {
-		return nil
-	}
-
-	return result
-}
@@ -0,0 +1,81 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+var (
+	jellyfinRetries      = kingpin.Flag("jellyfin.retries", "Number of times a Jellyfin API request is retried when the server is unavailable.").Default("2").Int()
+	jellyfinRetryBackoff = kingpin.Flag("jellyfin.retry-backoff", "Base delay between retries of a Jellyfin API request. It doubles with every retry and is jittered.").Default("250ms").Duration()
+)
+
+func retryPolicy() (retries int, backoff time.Duration) {
+	retries, backoff = *jellyfinRetries, *jellyfinRetryBackoff
+	if r, ok := config.Retries(); ok {
+		retries = r
+	}
+	if b, ok := config.RetryBackoff(); ok {
+		backoff = b
+	}
+	return retries, backoff
+}
+
+// retryableStatus reports whether Jellyfin, or a proxy in front of it, only
+// temporarily failed to answer, for example while it restarts.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// maxRetryDelay caps the delay between retries, which would otherwise grow
+// without bound with the number of retries.
+const maxRetryDelay = 30 * time.Second
+
+// retryDelay returns the delay before retry number attempt+1, a random value
+// between half and all of backoff doubled attempt times, up to maxRetryDelay.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	d := min(backoff, maxRetryDelay)
+	for i := 0; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxRetryDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep waits for d and reports whether ctx was still active afterwards.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rebelcore/jellyfin_exporter/config"
+)
+
+func setRetryPolicy(t *testing.T, retries int, backoff time.Duration) {
+	t.Helper()
+	oldRetries, oldBackoff := *jellyfinRetries, *jellyfinRetryBackoff
+	*jellyfinRetries, *jellyfinRetryBackoff = retries, backoff
+	t.Cleanup(func() {
+		*jellyfinRetries, *jellyfinRetryBackoff = oldRetries, oldBackoff
+	})
+}
+
+// statusServer answers with the given statuses in turn, and with 200 and an
+// empty JSON object once they are used up.
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		max := backoff << attempt
+		for i := 0; i < 100; i++ {
+			if d := retryDelay(backoff, attempt); d < max/2 || d > max {
+				t.Fatalf("retry %d: got delay %s, want between %s and %s", attempt, d, max/2, max)
+			}
+		}
+	}
+	for _, attempt := range []int{10, 64, 1000} {
+		if d := retryDelay(time.Second, attempt); d < maxRetryDelay/2 || d > maxRetryDelay {
+			t.Errorf("retry %d: got delay %s, want at most %s", attempt, d, maxRetryDelay)
+		}
+	}
+	if d := retryDelay(0, 3); d != 0 {
+		t.Errorf("got delay %s without backoff, want 0", d)
+	}
+}
+
+func TestGetRetries(t *testing.T) {
+	setRetryPolicy(t, 2, time.Millisecond)
+	setCircuitPolicy(t, 5, time.Hour)
+
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		requests int32
+		failures int
+		ok       bool
+	}{
+		{name: "recovers", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway}, requests: 3, ok: true},
+		{name: "gives up", statuses: []int{503, 503, 503}, requests: 3, failures: 1},
+		{name: "not retryable", statuses: []int{http.StatusNotFound}, requests: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, requests := statusServer(t, tc.statuses...)
+			client := NewClient(config.Target{URL: srv.URL})
+			var v struct{}
+			err := client.Get(context.Background(), "/System/Info", &v)
+			if (err == nil) != tc.ok {
+				t.Errorf("got error %v", err)
+			}
+			if n := requests.Load(); n != tc.requests {
+				t.Errorf("got %d requests, want %d", n, tc.requests)
+			}
+			if b := circuitBreakerFor(srv.URL); b.failures != tc.failures {
+				t.Errorf("got %d breaker failures, want %d", b.failures, tc.failures)
+			}
+		})
+	}
+}
+
+func TestGetDoneContext(t *testing.T) {
+	setRetryPolicy(t, 2, time.Hour)
+	setCircuitPolicy(t, 1, time.Hour)
+	var v struct{}
+
+	srv, requests := statusServer(t, 503)
+	client := NewClient(config.Target{URL: srv.URL})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := client.Get(ctx, "/System/Info", &v); err == nil {
+		t.Fatal("expected an error")
+	}
+	if b := circuitBreakerFor(srv.URL); b.state != circuitClosed || b.failures != 0 {
+		t.Errorf("cancelled scrape was counted as a failure, state %d, failures %d", b.state, b.failures)
+	}
+	if err := client.Get(ctx, "/System/Info", &v); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+
+	srv, _ = statusServer(t, 503)
+	client = NewClient(config.Target{URL: srv.URL})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Get(ctx, "/System/Info", &v); err == nil {
+		t.Fatal("expected an error")
+	}
+	if b := circuitBreakerFor(srv.URL); b.state != circuitOpen {
+		t.Errorf("collector timeout didn't open the breaker, state %d", b.state)
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	promconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	configFile = kingpin.Flag("config.file", "Path to the jellyfin_exporter configuration file.").PlaceHolder("FILE").String()
+)
+
+// Config is the content of the file given by --config.file. Settings in the
+// file take precedence over the matching command-line flags.
+type Config struct {
+	Jellyfin   JellyfinConfig             `yaml:"jellyfin"`
+	Collectors map[string]CollectorConfig `yaml:"collectors"`
+	Modules    map[string]Module          `yaml:"modules"`
+	Sessions   SessionsConfig             `yaml:"sessions"`
+	Privacy    PrivacyConfig              `yaml:"privacy"`
+}
+
+// JellyfinConfig holds the connection settings for the default Jellyfin server.
+type JellyfinConfig struct {
+	Address      string            `yaml:"address"`
+	Token        promconfig.Secret `yaml:"token"`
+	TokenFile    string            `yaml:"token_file"`
+	Username     string            `yaml:"username"`
+	PasswordFile string            `yaml:"password_file"`
+	DeviceID     string            `yaml:"device_id"`
+	Retries      *int              `yaml:"retries"`
+	RetryBackoff *model.Duration   `yaml:"retry_backoff"`
+}
+
+// CollectorConfig holds the settings of a single collector. Any key other
+// than the ones below is a collector specific option.
+type CollectorConfig struct {
+	Enabled      *bool             `yaml:"enabled"`
+	Timeout      *model.Duration   `yaml:"timeout"`
+	PollInterval *model.Duration   `yaml:"poll_interval"`
+	Options      map[string]string `yaml:",inline"`
+}
+
+// SessionsConfig selects the sessions that are left out of the metrics of
+// the users and playing collectors.
+type SessionsConfig struct {
+	ExcludeClients     []string `yaml:"exclude_clients"`
+	ExcludeDeviceIDs   []string `yaml:"exclude_device_ids"`
+	ExcludeWithoutUser bool     `yaml:"exclude_without_user"`
+	LANNetworks        []string `yaml:"lan_networks"`
+}
+
+// Privacy actions applied to label values.
+const (
+	PrivacyDrop     = "drop"
+	PrivacyHash     = "hash"
+	PrivacyTruncate = "truncate"
+)
+
+// PrivacyConfig maps label names to the privacy action applied to them in
+// the metrics of all collectors.
+type PrivacyConfig struct {
+	Salt   promconfig.Secret `yaml:"salt"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+// Module holds the credentials used when probing a target with /probe.
+type Module struct {
+	Token     promconfig.Secret `yaml:"token"`
+	TokenFile string            `yaml:"token_file"`
+	// Targets are the hosts, with an optional port, and URL prefixes the
+	// token of the module may be sent to.
+	Targets []string `yaml:"targets"`
+}
+
+var (
+	currentConfigMtx = sync.RWMutex{}
+	currentConfig    = &Config{}
+
+	collectorOptions = make(map[string]map[string]bool)
+)
+
+// RegisterCollector declares a collector and the options it reads from the
+// config file. Files naming other collectors or options are rejected.
+func RegisterCollector(collector string, options ...string) {
+	if collectorOptions[collector] == nil {
+		collectorOptions[collector] = make(map[string]bool)
+	}
+	for _, option := range options {
+		collectorOptions[collector][option] = true
+	}
+}
+
+// LoadFile parses the configuration file at path.
+func LoadFile(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %w", path, err)
+	}
+	if err := validateCredentials(string(cfg.Jellyfin.Token), cfg.Jellyfin.TokenFile, cfg.Jellyfin.Username, cfg.Jellyfin.PasswordFile, "jellyfin"); err != nil {
+		return nil, err
+	}
+	if r := cfg.Jellyfin.Retries; r != nil && (*r < 0 || *r > MaxRetries) {
+		return nil, fmt.Errorf("jellyfin: retries must be between 0 and %d", MaxRetries)
+	}
+	for name, c := range cfg.Collectors {
+		options, ok := collectorOptions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collector in config file: %s", name)
+		}
+		for option := range c.Options {
+			if !options[option] {
+				return nil, fmt.Errorf("collector %q: unknown option %q", name, option)
+			}
+		}
+	}
+	for _, network := range cfg.Sessions.LANNetworks {
+		if _, err := netip.ParsePrefix(network); err != nil {
+			return nil, fmt.Errorf("sessions: invalid LAN network: %w", err)
+		}
+	}
+	for label, action := range cfg.Privacy.Labels {
+		switch action {
+		case PrivacyDrop, PrivacyHash, PrivacyTruncate:
+		default:
+			return nil, fmt.Errorf("privacy: unknown action %q for label %q", action, label)
+		}
+		if action == PrivacyHash && cfg.Privacy.Salt == "" {
+			return nil, fmt.Errorf("privacy: label %q is hashed but no salt is set", label)
+		}
+	}
+	for name, module := range cfg.Modules {
+		if module.Token == "" && module.TokenFile == "" {
+			return nil, fmt.Errorf("module %q has no token", name)
+		}
+		if err := validateCredentials(string(module.Token), module.TokenFile, "", "", fmt.Sprintf("module %q", name)); err != nil {
+			return nil, err
+		}
+		if len(module.Targets) == 0 {
+			return nil, fmt.Errorf("module %q has no targets", name)
+		}
+		for _, target := range module.Targets {
+			if err := validateModuleTarget(target); err != nil {
+				return nil, fmt.Errorf("module %q: %w", name, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Load reads the file given by --config.file, if any, and makes it the
+// current configuration. It is safe to call again to reload the file.
+func Load(logger *slog.Logger) error {
+	cfg := &Config{}
+	if *configFile != "" {
+		var err error
+		cfg, err = LoadFile(*configFile)
+		if err != nil {
+			return err
+		}
+		logger.Info("Loaded config file", "file", *configFile, "collectors", len(cfg.Collectors), "modules", len(cfg.Modules))
+	}
+	if err := validateCredentials(*jellyfinToken, *jellyfinTokenFile, *jellyfinUsername, *jellyfinPasswordFile, "flags"); err != nil {
+		return err
+	}
+	if cfg.Jellyfin.Token == "" && cfg.Jellyfin.TokenFile == "" && cfg.Jellyfin.Username == "" &&
+		*jellyfinToken == "" && *jellyfinTokenFile == "" && *jellyfinUsername == "" {
+		// Without a default server, modules can still be probed.
+		if len(cfg.Modules) == 0 || jellyfinURLSet || cfg.Jellyfin.Address != "" {
+			return fmt.Errorf("a Jellyfin API token is required, set --jellyfin.token, --jellyfin.token-file or the JELLYFIN_TOKEN environment variable, or log in with --jellyfin.username")
+		}
+		logger.Info("No default Jellyfin server configured, only /probe scrapes Jellyfin")
+	}
+
+	currentConfigMtx.Lock()
+	defer currentConfigMtx.Unlock()
+	currentConfig = cfg
+	return nil
+}
+
+func current() *Config {
+	currentConfigMtx.RLock()
+	defer currentConfigMtx.RUnlock()
+	return currentConfig
+}
+
+// LookupModule returns the module with the given name from the current
+// configuration.
+func LookupModule(name string) (Module, bool) {
+	module, ok := current().Modules[name]
+	return module, ok
+}
+
+// DeviceID returns the device ID the exporter reports to Jellyfin from the
+// config file. ok is false when the file doesn't set one.
+func DeviceID() (deviceID string, ok bool) {
+	id := current().Jellyfin.DeviceID
+	return id, id != ""
+}
+
+// MaxRetries is the largest number of retries the config file accepts.
+const MaxRetries = 10
+
+// Retries returns the number of times a failed Jellyfin API request is
+// retried from the config file. ok is false when the file doesn't set it.
+func Retries() (retries int, ok bool) {
+	r := current().Jellyfin.Retries
+	if r == nil {
+		return 0, false
+	}
+	return *r, true
+}
+
+// RetryBackoff returns the base delay between retries from the config file.
+// ok is false when the file doesn't set it.
+func RetryBackoff() (backoff time.Duration, ok bool) {
+	b := current().Jellyfin.RetryBackoff
+	if b == nil {
+		return 0, false
+	}
+	return time.Duration(*b), true
+}
+
+// Sessions returns the session filters of the config file.
+func Sessions() SessionsConfig {
+	return current().Sessions
+}
+
+// Privacy returns the privacy settings of the config file.
+func Privacy() PrivacyConfig {
+	return current().Privacy
+}
+
+// CollectorEnabled reports whether the config file enables or disables the
+// named collector. ok is false when the file doesn't mention it.
+func CollectorEnabled(collector string) (enabled bool, ok bool) {
+	c, exist := current().Collectors[collector]
+	if !exist || c.Enabled == nil {
+		return false, false
+	}
+	return *c.Enabled, true
+}
+
+// CollectorTimeout returns the timeout of the named collector from the
+// config file. ok is false when the file doesn't set one.
+func CollectorTimeout(collector string) (timeout time.Duration, ok bool) {
+	c, exist := current().Collectors[collector]
+	if !exist || c.Timeout == nil {
+		return 0, false
+	}
+	return time.Duration(*c.Timeout), true
+}
+
+// CollectorPollInterval returns the background refresh interval of the named
+// collector from the config file. ok is false when the file doesn't set one.
+func CollectorPollInterval(collector string) (interval time.Duration, ok bool) {
+	c, exist := current().Collectors[collector]
+	if !exist || c.PollInterval == nil {
+		return 0, false
+	}
+	return time.Duration(*c.PollInterval), true
+}
+
+// CollectorNames returns the names of all collectors in the config file.
+func CollectorNames() []string {
+	names := []string{}
+	for name := range current().Collectors {
+		names = append(names, name)
+	}
+	return names
+}
+
+// CollectorOption returns an option of the named collector from the config
+// file, or fallback if it is not set.
+func CollectorOption(collector, key, fallback string) string {
+	if value, ok := current().Collectors[collector].Options[key]; ok {
+		return value
+	}
+	return fallback
+}
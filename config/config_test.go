@@ -0,0 +1,183 @@
+// Copyright 2010 Rebel Media
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func init() {
+	RegisterCollector("activity", "days")
+	RegisterCollector("playing")
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name: "valid",
+			content: `
+jellyfin:
+  address: http://jellyfin:8096
+  token: TOKEN
+  retries: 3
+  retry_backoff: 1s
+collectors:
+  activity:
+    enabled: true
+    timeout: 5s
+    days: "7"
+  playing:
+    poll_interval: 30s
+modules:
+  household:
+    token: TOKEN
+    targets: [jellyfin-living-room:8096, https://lab.example.com/jellyfin]
+sessions:
+  lan_networks: [10.0.0.0/8, "fd00::/8"]
+privacy:
+  salt: pepper
+  labels:
+    username: hash
+    ip_address: truncate
+    title: drop
+`,
+		},
+		{
+			name:    "unknown key",
+			content: "jellyfin:\n  adress: http://jellyfin:8096\n",
+			err:     "field adress not found",
+		},
+		{
+			name:    "unknown section",
+			content: "collector:\n  activity:\n    enabled: true\n",
+			err:     "field collector not found",
+		},
+		{
+			name:    "unknown collector",
+			content: "collectors:\n  activty:\n    enabled: true\n",
+			err:     "unknown collector in config file: activty",
+		},
+		{
+			name:    "unknown option",
+			content: "collectors:\n  activity:\n    dayz: \"7\"\n",
+			err:     `collector "activity": unknown option "dayz"`,
+		},
+		{
+			name:    "token and token file",
+			content: "jellyfin:\n  token: TOKEN\n  token_file: /token\n",
+			err:     "at most one of token and token file",
+		},
+		{
+			name:    "token and username",
+			content: "jellyfin:\n  token: TOKEN\n  username: exporter\n  password_file: /password\n",
+			err:     "a token and a username can't be used together",
+		},
+		{
+			name:    "username without password file",
+			content: "jellyfin:\n  username: exporter\n",
+			err:     "username and password file must be set together",
+		},
+		{
+			name:    "negative retries",
+			content: "jellyfin:\n  retries: -1\n",
+			err:     "retries must be between 0 and 10",
+		},
+		{
+			name:    "too many retries",
+			content: "jellyfin:\n  retries: 1000\n",
+			err:     "retries must be between 0 and 10",
+		},
+		{
+			name:    "bad LAN network",
+			content: "sessions:\n  lan_networks: [10.0.0.0]\n",
+			err:     "sessions: invalid LAN network",
+		},
+		{
+			name:    "unknown privacy action",
+			content: "privacy:\n  labels:\n    username: redact\n",
+			err:     `privacy: unknown action "redact" for label "username"`,
+		},
+		{
+			name:    "hash without salt",
+			content: "privacy:\n  labels:\n    username: hash\n",
+			err:     `privacy: label "username" is hashed but no salt is set`,
+		},
+		{
+			name:    "module without token",
+			content: "modules:\n  household:\n    targets: [jellyfin]\n",
+			err:     `module "household" has no token`,
+		},
+		{
+			name:    "module without targets",
+			content: "modules:\n  household:\n    token: TOKEN\n",
+			err:     `module "household" has no targets`,
+		},
+		{
+			name:    "module with bad target",
+			content: "modules:\n  household:\n    token: TOKEN\n    targets: [ftp://jellyfin]\n",
+			err:     `module "household": invalid target "ftp://jellyfin"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfigFile(t, tc.content))
+			switch {
+			case tc.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.err != "" && err == nil:
+				t.Errorf("expected error containing %q", tc.err)
+			case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+				t.Errorf("got error %q, want it to contain %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestLoadKeepsConfigOnError(t *testing.T) {
+	oldConfigFile, oldToken := *configFile, *jellyfinToken
+	t.Cleanup(func() {
+		*configFile, *jellyfinToken = oldConfigFile, oldToken
+		currentConfig = &Config{}
+	})
+	*jellyfinToken = "TOKEN"
+	logger := slog.New(slog.DiscardHandler)
+
+	*configFile = writeConfigFile(t, "collectors:\n  activity:\n    days: \"7\"\n")
+	if err := Load(logger); err != nil {
+		t.Fatal(err)
+	}
+	*configFile = writeConfigFile(t, "collectors:\n  activity:\n    dayz: \"30\"\n")
+	if err := Load(logger); err == nil {
+		t.Fatal("expected an error")
+	}
+	if days := CollectorOption("activity", "days", "1"); days != "7" {
+		t.Errorf("got days %q from the previous config, want 7", days)
+	}
+}
@@ -14,19 +14,241 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 )
 
 var (
-	jellyfinURL   = kingpin.Flag("jellyfin.address", "Address to use for connecting to Jellyfin").PlaceHolder("http://localhost:8096").Default("http://localhost:8096").String()
-	jellyfinToken = kingpin.Flag("jellyfin.token", "API Token to use for connecting to Jellyfin").Required().PlaceHolder("TOKEN").String()
+	jellyfinURL          = kingpin.Flag("jellyfin.address", "Address to use for connecting to Jellyfin").PlaceHolder("http://localhost:8096").IsSetByUser(&jellyfinURLSet).Default("http://localhost:8096").String()
+	jellyfinToken        = kingpin.Flag("jellyfin.token", "API Token to use for connecting to Jellyfin").Envar("JELLYFIN_TOKEN").PlaceHolder("TOKEN").String()
+	jellyfinTokenFile    = kingpin.Flag("jellyfin.token-file", "File containing the API Token to use for connecting to Jellyfin. The file is read again when it changes.").PlaceHolder("FILE").String()
+	jellyfinUsername     = kingpin.Flag("jellyfin.username", "User to log in as instead of using an API Token. Requires --jellyfin.password-file.").PlaceHolder("USER").String()
+	jellyfinPasswordFile = kingpin.Flag("jellyfin.password-file", "File containing the password of --jellyfin.username.").PlaceHolder("FILE").String()
 )
 
-func JellyfinInfo(logger *slog.Logger) (string, string, error) {
-	logger.Debug("Jellyfin URL", "Value", *jellyfinURL)
-	logger.Debug("Jellyfin Token", "Value", *jellyfinToken)
+var jellyfinURLSet bool
 
-	return *jellyfinURL, *jellyfinToken, nil
+// ErrNoDefaultTarget is returned by DefaultTarget when no default Jellyfin
+// server is configured and the exporter only scrapes modules through /probe.
+var ErrNoDefaultTarget = errors.New("no default Jellyfin server configured")
+
+// Target is a Jellyfin server the collectors talk to.
+type Target struct {
+	URL          string
+	token        string
+	tokenFile    string
+	username     string
+	passwordFile string
+}
+
+// Token returns the API token of the target. A token file is read again
+// whenever its modification time or size changes.
+func (t Target) Token() (string, error) {
+	if t.tokenFile != "" {
+		return readSecretFile(t.tokenFile)
+	}
+	return t.token, nil
+}
+
+// Username returns the user to log in as. It is empty when the target is
+// accessed with an API token.
+func (t Target) Username() string {
+	return t.username
+}
+
+// Password returns the password of Username, read from the password file.
+func (t Target) Password() (string, error) {
+	return readSecretFile(t.passwordFile)
+}
+
+// LogValue implements slog.LogValuer so that the token is never logged.
+func (t Target) LogValue() slog.Value {
+	if t.username != "" {
+		return slog.GroupValue(
+			slog.String("url", t.URL),
+			slog.String("username", t.username),
+			slog.String("password", "file:"+t.passwordFile),
+		)
+	}
+	token := "<redacted>"
+	if t.tokenFile != "" {
+		token = "file:" + t.tokenFile
+	}
+	return slog.GroupValue(
+		slog.String("url", t.URL),
+		slog.String("token", token),
+	)
+}
+
+type secretFileCache struct {
+	modTime time.Time
+	size    int64
+	secret  string
+}
+
+var (
+	secretFilesMtx = sync.Mutex{}
+	secretFiles    = make(map[string]secretFileCache)
+)
+
+// readSecretFile returns the trimmed content of the token or password file at
+// path. The file is only read again when its modification time or size changes.
+func readSecretFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file: %w", err)
+	}
+
+	secretFilesMtx.Lock()
+	defer secretFilesMtx.Unlock()
+	if cached, ok := secretFiles[path]; ok && cached.modTime.Equal(fi.ModTime()) && cached.size == fi.Size() {
+		return cached.secret, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file: %w", err)
+	}
+	secret := strings.TrimSpace(string(content))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %q is empty", path)
+	}
+	secretFiles[path] = secretFileCache{modTime: fi.ModTime(), size: fi.Size(), secret: secret}
+	return secret, nil
+}
+
+func validateCredentials(token, tokenFile, username, passwordFile, where string) error {
+	if token != "" && tokenFile != "" {
+		return fmt.Errorf("%s: at most one of token and token file must be set", where)
+	}
+	if (username == "") != (passwordFile == "") {
+		return fmt.Errorf("%s: username and password file must be set together", where)
+	}
+	if username != "" && (token != "" || tokenFile != "") {
+		return fmt.Errorf("%s: a token and a username can't be used together", where)
+	}
+	return nil
+}
+
+// DefaultTarget returns the Jellyfin server configured by the config file or
+// the command line.
+func DefaultTarget(logger *slog.Logger) (Target, error) {
+	target := Target{
+		URL:          *jellyfinURL,
+		token:        *jellyfinToken,
+		tokenFile:    *jellyfinTokenFile,
+		username:     *jellyfinUsername,
+		passwordFile: *jellyfinPasswordFile,
+	}
+	cfg := current()
+	if cfg.Jellyfin.Address != "" {
+		target.URL = cfg.Jellyfin.Address
+	}
+	if cfg.Jellyfin.Token != "" || cfg.Jellyfin.TokenFile != "" {
+		target.token, target.tokenFile = string(cfg.Jellyfin.Token), cfg.Jellyfin.TokenFile
+		target.username, target.passwordFile = "", ""
+	}
+	if cfg.Jellyfin.Username != "" {
+		target.username, target.passwordFile = cfg.Jellyfin.Username, cfg.Jellyfin.PasswordFile
+		target.token, target.tokenFile = "", ""
+	}
+	if target.token == "" && target.tokenFile == "" && target.username == "" {
+		return Target{}, ErrNoDefaultTarget
+	}
+	logger.Debug("Jellyfin target", "Value", target)
+
+	return target, nil
+}
+
+// LoginTarget returns the Jellyfin server at url, logged in to as username
+// with the password read from passwordFile.
+func LoginTarget(url, username, passwordFile string) Target {
+	return Target{URL: url, username: username, passwordFile: passwordFile}
+}
+
+// ProbeTarget returns the Jellyfin server at address, authenticated with the
+// token of the named module.
+func ProbeTarget(address, moduleName string) (Target, error) {
+	if address == "" {
+		return Target{}, fmt.Errorf("target parameter is missing")
+	}
+	if moduleName == "" {
+		return Target{}, fmt.Errorf("module parameter is missing")
+	}
+	module, ok := LookupModule(moduleName)
+	if !ok {
+		return Target{}, fmt.Errorf("unknown module %q", moduleName)
+	}
+
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid target %q: %w", address, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Target{}, fmt.Errorf("invalid target %q: unsupported scheme %q", address, u.Scheme)
+	}
+	if u.Host == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing host", address)
+	}
+	if u.User != nil {
+		return Target{}, fmt.Errorf("invalid target %q: user info is not supported", address)
+	}
+	if !module.allows(u) {
+		return Target{}, fmt.Errorf("target %q is not allowed for module %q", address, moduleName)
+	}
+	return Target{
+		URL:       strings.TrimSuffix(u.String(), "/"),
+		token:     string(module.Token),
+		tokenFile: module.TokenFile,
+	}, nil
+}
+
+// validateModuleTarget checks an entry of the targets of a module, either a
+// host with an optional port or a URL prefix.
+func validateModuleTarget(target string) error {
+	if !strings.Contains(target, "://") {
+		if target == "" || strings.ContainsAny(target, "/@") {
+			return fmt.Errorf("invalid target %q: must be a host or a URL", target)
+		}
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("invalid target %q: must be an http or https URL with a host", target)
+	}
+	return nil
+}
+
+// allows reports whether the token of m may be sent to the server at u. A
+// host entry matches any scheme and, without a port, any port. A URL entry
+// matches the URL and the paths below it.
+func (m Module) allows(u *url.URL) bool {
+	address := strings.TrimSuffix(u.String(), "/")
+	for _, target := range m.Targets {
+		if !strings.Contains(target, "://") {
+			if strings.EqualFold(target, u.Host) || strings.EqualFold(target, u.Hostname()) {
+				return true
+			}
+			continue
+		}
+		prefix := strings.TrimSuffix(target, "/")
+		if len(address) >= len(prefix) && strings.EqualFold(address[:len(prefix)], prefix) &&
+			(len(address) == len(prefix) || address[len(prefix)] == '/') {
+			return true
+		}
+	}
+	return false
 }
@@ -14,15 +14,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"os/user"
 	"runtime"
 	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
@@ -37,10 +42,15 @@ import (
 	"github.com/prometheus/exporter-toolkit/web/kingpinflag"
 
 	"github.com/rebelcore/jellyfin_exporter/collector"
+	"github.com/rebelcore/jellyfin_exporter/collector/utils"
+	"github.com/rebelcore/jellyfin_exporter/config"
 )
 
 type handler struct {
+	mtx                     sync.RWMutex
 	unfilteredHandler       http.Handler
+	filteredHandlers        map[string]http.Handler
+	generation              uint64
 	enabledCollectors       []string
 	exporterMetricsRegistry *prometheus.Registry
 	includeExporterMetrics  bool
@@ -60,16 +70,30 @@ func newHandler(includeExporterMetrics bool, maxRequests int, logger *slog.Logge
 			promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}),
 			promcollectors.NewGoCollector(),
 		)
+		utils.RegisterMetrics(h.exporterMetricsRegistry)
 	}
-	if innerHandler, err := h.innerHandler(); err != nil {
+	if err := h.reload(); err != nil {
 		h.logger.Error("Couldn't create metrics handler", "err", err)
 		return nil
-	} else {
-		h.unfilteredHandler = innerHandler
 	}
 	return h
 }
 
+// reload rebuilds the unfiltered handler so that it picks up the current
+// collector settings. Scrapes already in progress finish on the old one.
+func (h *handler) reload() error {
+	innerHandler, err := h.innerHandler()
+	if err != nil {
+		return err
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.unfilteredHandler = innerHandler
+	h.filteredHandlers = make(map[string]http.Handler)
+	h.generation++
+	return nil
+}
+
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	collects := r.URL.Query()["collect[]"]
 	h.logger.Debug("collect query:", "collects", collects)
@@ -77,94 +101,231 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	excludes := r.URL.Query()["exclude[]"]
 	h.logger.Debug("exclude query:", "excludes", excludes)
 
+	h.mtx.RLock()
+	unfilteredHandler, enabledCollectors := h.unfilteredHandler, h.enabledCollectors
+	h.mtx.RUnlock()
+
 	if len(collects) == 0 && len(excludes) == 0 {
-		h.unfilteredHandler.ServeHTTP(w, r)
+		unfilteredHandler.ServeHTTP(w, r)
 		return
 	}
 
 	if len(collects) > 0 && len(excludes) > 0 {
 		h.logger.Debug("rejecting combined collect and exclude queries")
-		fmt.Fprintf(os.Stderr, "Combined collect and exclude queries are not allowed.")
+		http.Error(w, "Combined collect[] and exclude[] queries are not allowed.", http.StatusBadRequest)
 		return
 	}
 
-	filters := &collects
+	filters := collects
 	if len(excludes) > 0 {
-		f := []string{}
-		for _, c := range h.enabledCollectors {
-			if (slices.Index(excludes, c)) == -1 {
-				f = append(f, c)
+		for _, c := range excludes {
+			if !collector.IsKnownCollector(c) {
+				http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s: %s", collector.ErrUnknownCollector, c), http.StatusBadRequest)
+				return
+			}
+		}
+		filters = []string{}
+		for _, c := range enabledCollectors {
+			if !slices.Contains(excludes, c) {
+				filters = append(filters, c)
 			}
 		}
-		filters = &f
+		if len(filters) == 0 {
+			http.Error(w, "exclude[] query excludes all enabled collectors.", http.StatusBadRequest)
+			return
+		}
 	}
 
-	filteredHandler, err := h.innerHandler(*filters...)
+	filteredHandler, err := h.filteredHandler(filters)
 	if err != nil {
 		h.logger.Warn("Couldn't create filtered metrics handler:", "err", err)
-		fmt.Fprintf(os.Stderr, "Couldn't create filtered metrics handler: %s\n", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, collector.ErrUnknownCollector) || errors.Is(err, collector.ErrDisabledCollector) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Couldn't create filtered metrics handler: %s", err), status)
 		return
 	}
 	filteredHandler.ServeHTTP(w, r)
 }
 
+// filteredHandler returns the handler for the given collectors. Handlers are
+// cached per set of collectors until the next reload.
+func (h *handler) filteredHandler(filters []string) (http.Handler, error) {
+	filters = slices.Clone(filters)
+	slices.Sort(filters)
+	filters = slices.Compact(filters)
+	key := strings.Join(filters, ",")
+
+	h.mtx.RLock()
+	generation := h.generation
+	cached, ok := h.filteredHandlers[key]
+	h.mtx.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	filteredHandler, err := h.innerHandler(filters...)
+	if err != nil {
+		return nil, err
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	// Don't cache a handler built before a reload replaced the cache.
+	if generation != h.generation {
+		return filteredHandler, nil
+	}
+	if cached, ok := h.filteredHandlers[key]; ok {
+		return cached, nil
+	}
+	h.filteredHandlers[key] = filteredHandler
+	return filteredHandler, nil
+}
+
 func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 	nc, err := collector.NewJellyfinCollector(h.logger, filters...)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create collector: %s", err)
+		return nil, fmt.Errorf("couldn't create collector: %w", err)
 	}
 
 	if len(filters) == 0 {
 		h.logger.Info("Enabled collectors")
+		enabledCollectors := []string{}
 		for n := range nc.Collectors {
-			h.enabledCollectors = append(h.enabledCollectors, n)
+			enabledCollectors = append(enabledCollectors, n)
 		}
-		sort.Strings(h.enabledCollectors)
-		for _, c := range h.enabledCollectors {
+		sort.Strings(enabledCollectors)
+		for _, c := range enabledCollectors {
 			h.logger.Info(c)
 		}
-	}
-
-	r := prometheus.NewRegistry()
-	r.MustRegister(versioncollector.NewCollector("jellyfin_exporter"))
-	if err := r.Register(nc); err != nil {
-		return nil, fmt.Errorf("couldn't register jellyfin collector: %s", err)
+		h.mtx.Lock()
+		h.enabledCollectors = enabledCollectors
+		h.mtx.Unlock()
 	}
 
 	var handler http.Handler
 	if h.includeExporterMetrics {
-		handler = promhttp.HandlerFor(
-			prometheus.Gatherers{h.exporterMetricsRegistry, r},
-			promhttp.HandlerOpts{
-				ErrorLog:            slog.NewLogLogger(h.logger.Handler(), slog.LevelError),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: h.maxRequests,
-				Registry:            h.exporterMetricsRegistry,
-			},
-		)
+		handler = gatherHandler(nc, h.exporterMetricsRegistry, h.logger)
+		handler = limitRequests(h.maxRequests, handler)
 		handler = promhttp.InstrumentMetricHandler(
 			h.exporterMetricsRegistry, handler,
 		)
 	} else {
-		handler = promhttp.HandlerFor(
-			r,
-			promhttp.HandlerOpts{
-				ErrorLog:            slog.NewLogLogger(h.logger.Handler(), slog.LevelError),
-				ErrorHandling:       promhttp.ContinueOnError,
-				MaxRequestsInFlight: h.maxRequests,
-			},
-		)
+		handler = gatherHandler(nc, nil, h.logger)
+		handler = limitRequests(h.maxRequests, handler)
 	}
 
 	return handler, nil
 }
 
+// gatherHandler serves the metrics of nc. Every scrape runs with the context
+// of its request, so collectors stop as soon as the client gives up.
+func gatherHandler(nc *collector.JellyfinCollector, exporterMetricsRegistry *prometheus.Registry, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(versioncollector.NewCollector("jellyfin_exporter"))
+		if nc.Target != "" {
+			reg.MustRegister(utils.NewCircuitCollector(nc.Target))
+		}
+		if err := reg.Register(nc.WithContext(r.Context())); err != nil {
+			logger.Error("Couldn't register jellyfin collector", "err", err)
+			http.Error(w, fmt.Sprintf("Couldn't register jellyfin collector: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		var gatherer prometheus.Gatherer = reg
+		opts := promhttp.HandlerOpts{
+			ErrorLog:      slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			ErrorHandling: promhttp.ContinueOnError,
+		}
+		if exporterMetricsRegistry != nil {
+			gatherer = prometheus.Gatherers{exporterMetricsRegistry, reg}
+			opts.Registry = exporterMetricsRegistry
+		}
+		promhttp.HandlerFor(gatherer, opts).ServeHTTP(w, r)
+	})
+}
+
+// limitRequests rejects requests once maxRequests are in flight, in the same
+// way as the MaxRequestsInFlight option of promhttp.
+func limitRequests(maxRequests int, next http.Handler) http.Handler {
+	if maxRequests <= 0 {
+		return next
+	}
+	inFlightSem := make(chan struct{}, maxRequests)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case inFlightSem <- struct{}{}:
+			defer func() { <-inFlightSem }()
+		default:
+			http.Error(w, fmt.Sprintf("Limit of concurrent requests reached (%d), try again later.", maxRequests), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type probeHandler struct {
+	handler http.Handler
+	logger  *slog.Logger
+}
+
+func newProbeHandler(maxRequests int, logger *slog.Logger) *probeHandler {
+	h := &probeHandler{
+		logger: logger,
+	}
+	h.handler = limitRequests(maxRequests, http.HandlerFunc(h.probe))
+	return h
+}
+
+func (h *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(w, r)
+}
+
+func (h *probeHandler) probe(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target, err := config.ProbeTarget(params.Get("target"), params.Get("module"))
+	if err != nil {
+		h.logger.Debug("rejecting probe request", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logger := h.logger.With("target", target.URL, "module", params.Get("module"))
+	nc, err := collector.NewJellyfinProbeCollector(logger, target)
+	if err != nil {
+		logger.Warn("Couldn't create probe collector", "err", err)
+		http.Error(w, fmt.Sprintf("Couldn't create probe collector: %s", err), http.StatusInternalServerError)
+		return
+	}
+	gatherHandler(nc, nil, logger).ServeHTTP(w, r)
+}
+
+func reloadConfig(h *handler, logger *slog.Logger) error {
+	logger.Info("Reloading config")
+	if err := config.Load(logger); err != nil {
+		return err
+	}
+	if err := collector.ApplyConfig(); err != nil {
+		return err
+	}
+	if err := h.reload(); err != nil {
+		return err
+	}
+	logger.Info("Completed reloading config")
+	return nil
+}
+
 func main() {
 	var (
 		metricsPath = kingpin.Flag(
 			"web.telemetry-path",
 			"Path under which to expose metrics.",
 		).Default("/metrics").String()
+		probePath = kingpin.Flag(
+			"web.probe-path",
+			"Path under which to expose the multi-target probe endpoint.",
+		).Default("/probe").String()
 		disableExporterMetrics = kingpin.Flag(
 			"web.disable-exporter-metrics",
 			"Exclude metrics about the exporter itself (promhttp_*, process_*, go_*).",
@@ -202,7 +363,49 @@ func main() {
 	runtime.GOMAXPROCS(*maxProcs)
 	logger.Debug("Go MAXPROCS", "procs", runtime.GOMAXPROCS(0))
 
-	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests, logger))
+	if err := config.Load(logger); err != nil {
+		logger.Error("Error loading config", "err", err)
+		os.Exit(1)
+	}
+	if err := collector.ApplyConfig(); err != nil {
+		logger.Error("Error applying config", "err", err)
+		os.Exit(1)
+	}
+
+	metricsHandler := newHandler(!*disableExporterMetrics, *maxRequests, logger)
+	if metricsHandler == nil {
+		os.Exit(1)
+	}
+	http.Handle(*metricsPath, metricsHandler)
+	http.Handle(*probePath, newProbeHandler(*maxRequests, logger))
+
+	reloadCh := make(chan chan error)
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for {
+			select {
+			case <-hup:
+				if err := reloadConfig(metricsHandler, logger); err != nil {
+					logger.Error("Error reloading config", "err", err)
+				}
+			case errc := <-reloadCh:
+				errc <- reloadConfig(metricsHandler, logger)
+			}
+		}
+	}()
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "This endpoint requires a POST request.", http.StatusMethodNotAllowed)
+			return
+		}
+		errc := make(chan error)
+		reloadCh <- errc
+		if err := <-errc; err != nil {
+			logger.Error("Error reloading config", "err", err)
+			http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+		}
+	})
 	if *metricsPath != "/" {
 		landingConfig := web.LandingConfig{
 			Name:        "Jellyfin Exporter",
@@ -16,12 +16,20 @@ package main
 import (
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+
+	"github.com/rebelcore/jellyfin_exporter/collector"
 )
 
 var (
@@ -84,6 +92,91 @@ func TestHandlingOfDuplicatedMetrics(t *testing.T) {
 	}
 }
 
+var parseFlagsOnce sync.Once
+
+// newTestHandler returns a metrics handler talking to a fake Jellyfin server
+// that only answers pings.
+func newTestHandler(t *testing.T) *handler {
+	t.Helper()
+	parseFlagsOnce.Do(func() {
+		jellyfin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/System/Ping" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, `"Jellyfin Server"`)
+		}))
+		if _, err := kingpin.CommandLine.Parse([]string{"--jellyfin.address", jellyfin.URL, "--jellyfin.token", "TOKEN"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := collector.ApplyConfig(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	h := newHandler(false, 0, slog.New(slog.DiscardHandler))
+	if h == nil {
+		t.Fatal("couldn't create handler")
+	}
+	return h
+}
+
+func TestFilteredHandler(t *testing.T) {
+	h := newTestHandler(t)
+
+	for _, tc := range []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"collect", "collect[]=system", http.StatusOK, "jellyfin_up 1"},
+		{"exclude", "exclude[]=system", http.StatusOK, `jellyfin_scrape_collector_success{collector="server"}`},
+		{"collect and exclude", "collect[]=system&exclude[]=server", http.StatusBadRequest, "not allowed"},
+		{"unknown collect", "collect[]=nope", http.StatusBadRequest, "missing collector: nope"},
+		{"unknown exclude", "exclude[]=nope", http.StatusBadRequest, "missing collector: nope"},
+		{"disabled collect", "collect[]=activity", http.StatusBadRequest, "disabled collector: activity"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?"+tc.query, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("want status %d, have %d. Body:\n%s", tc.wantStatus, rec.Code, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("want body containing %q, have:\n%s", tc.wantBody, rec.Body)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?collect[]=system", nil))
+	if strings.Contains(rec.Body.String(), `collector="server"`) {
+		t.Errorf("want only the system collector, have:\n%s", rec.Body)
+	}
+}
+
+func TestFilteredHandlerCache(t *testing.T) {
+	h := newTestHandler(t)
+
+	for _, query := range []string{"collect[]=system&collect[]=server", "collect[]=server&collect[]=system", "collect[]=system&collect[]=server&collect[]=system"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("want status 200 for %q, have %d", query, rec.Code)
+		}
+	}
+	if len(h.filteredHandlers) != 1 {
+		t.Errorf("want 1 cached handler, have %d", len(h.filteredHandlers))
+	}
+
+	if err := h.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.filteredHandlers) != 0 {
+		t.Errorf("want empty cache after reload, have %d handlers", len(h.filteredHandlers))
+	}
+}
+
 func queryExporter(address string) error {
 	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", address))
 	if err != nil {